@@ -3,6 +3,8 @@ package structuredoutput
 import (
 	"context"
 	"fmt"
+	"log"
+	"slices"
 	"sync"
 	"time"
 
@@ -10,45 +12,100 @@ import (
 	"github.com/openai/openai-go/shared"
 )
 
-var client openai.Client
-var clientOnce sync.Once
-
-type ModelResp struct {
-	Content string `json:"content"`
-}
-
+// ChatContext is a conversation with the model. Its methods are safe for
+// concurrent use; the fields may be set directly while no other goroutine uses
+// the conversation, e.g. right after NewChatContext. Use Fork to branch many
+// conversations off one primed prefix.
 type ChatContext struct {
+	mu     sync.Mutex
 	Id     int
 	Memory Memory
+	// Provider serves the completions for this conversation.
+	// When nil the package DefaultProvider is used.
+	Provider Provider
+	Options  Options
+	// Calls records the usage of every model call (see TotalUsage).
+	Calls []CallUsage
+	// replaced counts the times the memory was swapped for a new one, so that
+	// a memory fitted without the lock is not put over a newer one.
+	replaced int
 }
 
 type Memory struct {
 	Messages []openai.ChatCompletionMessageParamUnion
+	// Pinned is the number of leading messages memory strategies always keep (see Pin).
+	Pinned int
 }
 
-func getClient() openai.Client {
-
-	clientOnce.Do(func() {
-		client = openai.NewClient()
-	})
-	return client
-}
-
-func NewChatContext(id int) ChatContext {
-	return ChatContext{
+func NewChatContext(id int, opts ...Option) *ChatContext {
+	c := &ChatContext{
 		Id: id,
 		Memory: Memory{
 			Messages: []openai.ChatCompletionMessageParamUnion{},
 		},
+		Options: defaultOptions(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Fork returns a copy of the conversation that continues independently:
+// messages added to either one are not seen by the other. The fork shares the
+// provider and options, including a UsageTracker, but starts without Calls.
+func (c *ChatContext) Fork() *ChatContext {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &ChatContext{
+		Id:       c.Id,
+		Memory:   c.Memory.clone(),
+		Provider: c.Provider,
+		Options:  c.Options,
 	}
 }
 
+// Snapshot returns a copy of the memory as it is now.
+func (c *ChatContext) Snapshot() Memory {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Memory.clone()
+}
+
+// SetMemory replaces the memory with a copy of m, e.g. to prime a conversation anew.
+func (c *ChatContext) SetMemory(m Memory) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Memory = m.clone()
+	c.replaced++
+}
+
+// SetTools offers the tools in r to the model from the next call on, like WithTools.
+func (c *ChatContext) SetTools(r *ToolRegistry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Options.Tools = r
+}
+
+func (m Memory) clone() Memory {
+	return Memory{Messages: slices.Clone(m.Messages), Pinned: m.Pinned}
+}
+
+func (c *ChatContext) provider() Provider {
+	if c.Provider != nil {
+		return c.Provider
+	}
+	return DefaultProvider()
+}
+
 func (c *ChatContext) AddMessage(message openai.ChatCompletionMessageParamUnion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.Memory.Messages = append(c.Memory.Messages, message)
 }
 
 func (c *ChatContext) ViewConversation() {
-	for _, msg := range c.Memory.Messages {
+	for _, msg := range c.Snapshot().Messages {
 		if msg.OfAssistant != nil {
 			fmt.Println("Assistant:", msg.OfAssistant.Content.OfString)
 		}
@@ -61,32 +118,222 @@ func (c *ChatContext) ViewConversation() {
 		if msg.OfFunction != nil {
 			fmt.Println("Function:", msg.OfFunction.Name)
 		}
+		if msg.OfTool != nil {
+			fmt.Println("Tool:", msg.OfTool.Content.OfString)
+		}
 	}
 }
 
-func (c *ChatContext) GenerateResponseFromModel(respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam) (string, error) {
-	client := getClient()
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+// GenerateResponseFromModel is GenerateResponseFromModelContext with a background context.
+func (c *ChatContext) GenerateResponseFromModel(respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam) (Completion, error) {
+	return c.GenerateResponseFromModelContext(context.Background(), respSchema)
+}
 
-	resp, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model:    openai.ChatModelGPT4o,
-		Messages: c.Memory.Messages,
-		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
-			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{JSONSchema: respSchema},
-		},
-		Temperature: openai.Float(0.0),
-	})
+// GenerateResponseFromModelContext sends the conversation to the model and appends the reply to it.
+// Refusals and truncated replies are returned as they are; see Completion.Err.
+func (c *ChatContext) GenerateResponseFromModelContext(ctx context.Context, respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam) (Completion, error) {
+	return c.complete(ctx, respSchema, nil)
+}
+
+// complete sends the conversation to the model and appends the first choice to it.
+// When the model calls tools, the calls and their results are appended and the
+// model is asked again, for up to Options.MaxToolRounds rounds.
+// With a sink the completions are streamed to it.
+//
+// The conversation is not locked while the model answers, so concurrent
+// calls each send the messages present when they start.
+func (c *ChatContext) complete(ctx context.Context, respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam, sink *streamSink) (Completion, error) {
+	c.mu.Lock()
+	tools, maxRounds := c.Options.Tools, c.Options.MaxToolRounds
+	c.mu.Unlock()
+
+	var calls []CallUsage
+	for round := 0; ; round++ {
+		resp, call, err := c.completeOnce(ctx, respSchema, sink)
+		if err != nil {
+			return Completion{}, err
+		}
+		calls = append(calls, call)
+
+		msg := resp.Choices[0].Message
+		if len(msg.ToolCalls) == 0 || tools == nil {
+			c.AddMessage(openai.ChatCompletionMessageParamUnion{
+				OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+					Content: openai.ChatCompletionAssistantMessageParamContentUnion{
+						OfString: openai.String(msg.Content),
+					},
+				}})
+			return newCompletion(resp, calls), nil
+		}
+		if round >= maxRounds {
+			return Completion{}, fmt.Errorf("model still calling tools after %d rounds", round)
+		}
+
+		c.AddMessage(msg.ToParam())
+		for _, call := range msg.ToolCalls {
+			c.AddMessage(openai.ToolMessage(tools.Call(ctx, call), call.ID))
+		}
+	}
+}
+
+// completeOnce makes a single model call for the conversation.
+// The call is bounded by ctx and, when set, by the conversation's Options.Timeout.
+// With Options.RateLimiter it waits for the limits and is retried after rate limit errors.
+// A memory over Options.MemoryBudget is shrunk first.
+// With Options.Cache an identical earlier request is answered from the cache
+// and complete answers are stored in it.
+func (c *ChatContext) completeOnce(ctx context.Context, respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam, sink *streamSink) (*openai.ChatCompletion, CallUsage, error) {
+	if err := c.fitMemory(ctx); err != nil {
+		return nil, CallUsage{}, err
+	}
 
+	c.mu.Lock()
+	params := c.newParams(respSchema)
+	provider, timeout, limiter := c.provider(), c.Options.Timeout, c.Options.RateLimiter
+	tokens := c.Memory.Tokens() + int(c.Options.MaxTokens)
+	cache, ttl, bypass := c.Options.Cache, c.Options.CacheTTL, c.Options.CacheBypass
+	c.mu.Unlock()
+
+	var err error
+
+	var key string
+	if cache != nil {
+		if key, err = CacheKey(params); err != nil {
+			return nil, CallUsage{}, err
+		}
+		if !bypass {
+			resp, ok, err := cache.Get(ctx, key)
+			if err != nil {
+				return nil, CallUsage{}, err
+			}
+			if ok && len(resp.Choices) > 0 {
+				if sink != nil {
+					sink.replay(ctx, resp)
+				}
+				call := newCallUsage(params.Model, resp, 0)
+				call.Usage, call.Cached = Usage{}, true
+				c.recordUsage(call)
+				return resp, call, nil
+			}
+		}
+	}
+
+	var start time.Time
+	send := func(ctx context.Context) (*openai.ChatCompletion, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		start = time.Now()
+		if sink != nil {
+			return sink.stream(ctx, provider, params)
+		}
+		return provider.ChatCompletion(ctx, params)
+	}
+
+	var resp *openai.ChatCompletion
+	if limiter != nil {
+		resp, err = limiter.do(ctx, tokens, send)
+	} else {
+		resp, err = send(ctx)
+	}
+	if err != nil {
+		return nil, CallUsage{}, err
+	}
+	call := newCallUsage(params.Model, resp, time.Since(start))
+	c.recordUsage(call)
+	if len(resp.Choices) == 0 {
+		return nil, call, fmt.Errorf("model returned no choices")
+	}
+	if cache != nil && cacheable(resp) {
+		// A failed write only costs a later cache hit, not this answer.
+		if err := cache.Set(ctx, key, resp, ttl); err != nil {
+			log.Printf("Error caching response: %v", err)
+		}
+	}
+	return resp, call, nil
+}
+
+// cacheable reports whether a completion is worth answering again from the
+// cache: a refused, truncated or filtered answer is asked anew next time.
+func cacheable(resp *openai.ChatCompletion) bool {
+	choice := resp.Choices[0]
+	if choice.Message.Refusal != "" {
+		return false
+	}
+	return choice.FinishReason == "stop" || choice.FinishReason == "tool_calls"
+}
+
+func (c *ChatContext) recordUsage(call CallUsage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Calls = append(c.Calls, call)
+	if c.Options.Usage != nil && !call.Cached {
+		c.Options.Usage.Record(call)
+	}
+}
+
+// fitMemory applies the memory strategy when the conversation exceeds Options.MemoryBudget.
+// The strategy runs on a snapshot without c.mu held and within Options.Timeout,
+// as Summarize makes a model call of its own. Messages added meanwhile are kept
+// after the fitted ones.
+func (c *ChatContext) fitMemory(ctx context.Context) error {
+	c.mu.Lock()
+	memory, replaced := c.Memory.clone(), c.replaced
+	budget, strategy, timeout := c.Options.MemoryBudget, c.Options.MemoryStrategy, c.Options.Timeout
+	c.mu.Unlock()
+	if budget <= 0 || memory.Tokens() <= budget {
+		return nil
+	}
+	if strategy == nil {
+		strategy = SlidingWindow{}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	fitted, err := strategy.Fit(ctx, memory, budget)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	c.AddMessage(openai.ChatCompletionMessageParamUnion{
-		OfAssistant: &openai.ChatCompletionAssistantMessageParam{
-			Content: openai.ChatCompletionAssistantMessageParamContentUnion{
-				OfString: openai.String(resp.Choices[0].Message.Content),
-			},
-		}})
-	return resp.Choices[0].Message.RawJSON(), nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A memory replaced meanwhile, e.g. by a concurrent call's fit, is kept.
+	if c.replaced != replaced {
+		return nil
+	}
+	fitted.Messages = append(fitted.Messages, c.Memory.Messages[len(memory.Messages):]...)
+	c.Memory = fitted
+	c.replaced++
+	return nil
+}
 
+// newParams builds the completion request for the conversation from its Options.
+func (c *ChatContext) newParams(respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam) openai.ChatCompletionNewParams {
+	model := c.Options.Model
+	if model == "" {
+		model = c.provider().Model()
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Model:    model,
+		Messages: slices.Clone(c.Memory.Messages),
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{JSONSchema: respSchema},
+		},
+		Temperature: openai.Float(c.Options.Temperature),
+	}
+	if c.Options.MaxTokens > 0 {
+		params.MaxTokens = openai.Int(c.Options.MaxTokens)
+	}
+	if c.Options.Seed != nil {
+		params.Seed = openai.Int(*c.Options.Seed)
+	}
+	if c.Options.Tools != nil {
+		params.Tools = c.Options.Tools.Params()
+	}
+	return params
 }
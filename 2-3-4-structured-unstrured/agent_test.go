@@ -0,0 +1,273 @@
+package structuredoutput
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+var testSchema = shared.ResponseFormatJSONSchemaJSONSchemaParam{
+	Name:   "Answer",
+	Schema: map[string]any{"type": "object"},
+	Strict: openai.Bool(true),
+}
+
+// blockingProvider waits for the request context to end.
+type blockingProvider struct{}
+
+func (blockingProvider) Name() string  { return "blocking" }
+func (blockingProvider) Model() string { return "blocking" }
+func (blockingProvider) ChatCompletion(ctx context.Context, _ openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGenerateResponseFromModelOptions(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{}`)
+	conv := NewChatContext(1,
+		WithProvider(fake),
+		WithModel("gpt-4o-mini"),
+		WithTemperature(0.3),
+		WithMaxTokens(256),
+		WithSeed(42),
+	)
+	conv.AddMessage(openai.UserMessage("hi"))
+
+	if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+
+	params := fake.Calls()[0]
+	if params.Model != "gpt-4o-mini" {
+		t.Errorf("expected model override, got %q", params.Model)
+	}
+	if params.Temperature.Value != 0.3 {
+		t.Errorf("expected temperature 0.3, got %v", params.Temperature.Value)
+	}
+	if params.MaxTokens.Value != 256 {
+		t.Errorf("expected max tokens 256, got %v", params.MaxTokens.Value)
+	}
+	if params.Seed.Value != 42 {
+		t.Errorf("expected seed 42, got %v", params.Seed.Value)
+	}
+	if len(conv.Memory.Messages) != 2 {
+		t.Errorf("expected reply to be appended, got %d messages", len(conv.Memory.Messages))
+	}
+}
+
+func TestGenerateResponseFromModelTimeout(t *testing.T) {
+	conv := NewChatContext(1, WithProvider(blockingProvider{}), WithTimeout(20*time.Millisecond))
+	conv.AddMessage(openai.UserMessage("hi"))
+
+	_, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestGenerateResponseFromModelCancel(t *testing.T) {
+	conv := NewChatContext(1, WithProvider(blockingProvider{}), WithTimeout(0))
+	conv.AddMessage(openai.UserMessage("hi"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := conv.GenerateResponseFromModelContext(ctx, testSchema)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestGenerateResponseFromModelCompletion(t *testing.T) {
+	fake := NewFakeProvider().On("Answer", "",
+		FakeResponse{Refusal: "I can't help with that."},
+		FakeResponse{ToolCalls: []FakeToolCall{{ID: "call_1", Name: "add", Arguments: `{"a":1,"b":2}`}}},
+	)
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("hi"))
+
+	refused, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	if err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+	var refusal *RefusalError
+	if refused.Refusal != "I can't help with that." || !errors.As(refused.Err(), &refusal) {
+		t.Errorf("expected the refusal in the completion, got %+v", refused)
+	}
+	if refused.Model != "fake" || refused.Usage.Calls != 1 || refused.Usage.PromptTokens == 0 {
+		t.Errorf("expected model and usage in the completion, got %+v", refused)
+	}
+
+	// Without a ToolRegistry the tool calls are left to the caller.
+	called, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	if err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+	want := []ToolCallRecord{{ID: "call_1", Name: "add", Arguments: `{"a":1,"b":2}`}}
+	if called.FinishReason != "tool_calls" || !reflect.DeepEqual(called.ToolCalls, want) || called.Err() != nil {
+		t.Errorf("expected the tool calls in the completion, got %+v", called)
+	}
+}
+
+func TestNewCompletionChoices(t *testing.T) {
+	var resp openai.ChatCompletion
+	raw := `{"id":"1","model":"gpt-4o-2024-08-06","choices":[
+		{"index":0,"finish_reason":"length","message":{"role":"assistant","content":"{\"val"}},
+		{"index":1,"finish_reason":"stop","message":{"role":"assistant","content":"{}"}}]}`
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatal(err)
+	}
+	calls := []CallUsage{
+		{Model: "gpt-4o-2024-08-06", Usage: Usage{Calls: 1, PromptTokens: 10}},
+		{Model: "gpt-4o-2024-08-06", Usage: Usage{Calls: 1, PromptTokens: 20, CompletionTokens: 5}},
+	}
+	completion := newCompletion(&resp, calls)
+
+	var truncated *TruncatedError
+	if !errors.As(completion.Err(), &truncated) || truncated.Content != `{"val` {
+		t.Errorf("expected the first choice to be truncated, got %v", completion.Err())
+	}
+	if len(completion.Alternatives) != 1 || completion.Alternatives[0].Content != "{}" {
+		t.Errorf("expected the second choice as alternative, got %+v", completion.Alternatives)
+	}
+	if completion.Usage != (Usage{Calls: 2, PromptTokens: 30, CompletionTokens: 5}) {
+		t.Errorf("expected the usage of both calls, got %+v", completion.Usage)
+	}
+}
+
+// emptyProvider answers without choices.
+type emptyProvider struct{}
+
+func (emptyProvider) Name() string  { return "empty" }
+func (emptyProvider) Model() string { return "empty" }
+func (emptyProvider) ChatCompletion(ctx context.Context, _ openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	return &openai.ChatCompletion{}, nil
+}
+
+func TestGenerateResponseFromModelNoChoices(t *testing.T) {
+	conv := NewChatContext(1, WithProvider(emptyProvider{}))
+	conv.AddMessage(openai.UserMessage("hi"))
+
+	if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); err == nil {
+		t.Fatal("expected an error for a completion without choices")
+	}
+	if len(conv.Memory.Messages) != 1 {
+		t.Errorf("expected no reply to be appended, got %d messages", len(conv.Memory.Messages))
+	}
+}
+
+func newPrimedContext(opts ...Option) *ChatContext {
+	conv := NewChatContext(1, opts...)
+	conv.AddMessage(openai.SystemMessage("You answer with JSON."))
+	conv.AddMessage(openai.UserMessage("example question"))
+	conv.AddMessage(openai.AssistantMessage(`{}`))
+	conv.Memory.Pin()
+	return conv
+}
+
+func TestChatContextFork(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{}`)
+	primed := newPrimedContext(WithProvider(fake), WithModel("gpt-4o-mini"))
+
+	fork := primed.Fork()
+	fork.AddMessage(openai.UserMessage("question"))
+	if _, err := fork.GenerateResponseFromModelContext(context.Background(), testSchema); err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+
+	if len(primed.Memory.Messages) != 3 || len(primed.Calls) != 0 {
+		t.Errorf("expected the primed context to be unchanged, got %d messages and %d calls", len(primed.Memory.Messages), len(primed.Calls))
+	}
+	if len(fork.Memory.Messages) != 5 || fork.Memory.Pinned != 3 || len(fork.Calls) != 1 {
+		t.Errorf("expected the fork to continue from the prefix, got %d messages, %d pinned", len(fork.Memory.Messages), fork.Memory.Pinned)
+	}
+	if fake.Calls()[0].Model != "gpt-4o-mini" {
+		t.Errorf("expected the fork to keep the options, got model %q", fake.Calls()[0].Model)
+	}
+}
+
+// TestChatContextConcurrentForks branches many questions off one primed
+// context at once. Run with -race.
+func TestChatContextConcurrentForks(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{}`)
+	usage := NewUsageTracker()
+	primed := newPrimedContext(WithProvider(fake), WithUsage(usage))
+
+	const n = 20
+	forks := make([]*ChatContext, n)
+	var wg sync.WaitGroup
+	for i := range forks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			forks[i] = primed.Fork()
+			forks[i].AddMessage(openai.UserMessage(fmt.Sprintf("question %d", i)))
+			if _, err := forks[i].GenerateResponseFromModelContext(context.Background(), testSchema); err != nil {
+				t.Errorf("GenerateResponseFromModelContext: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, fork := range forks {
+		question := fork.Memory.Messages[3].OfUser.Content.OfString.Value
+		if len(fork.Memory.Messages) != 5 || question != fmt.Sprintf("question %d", i) {
+			t.Errorf("fork %d: unexpected memory with %d messages, question %q", i, len(fork.Memory.Messages), question)
+		}
+	}
+	if len(primed.Memory.Messages) != 3 {
+		t.Errorf("expected the primed context to be unchanged, got %d messages", len(primed.Memory.Messages))
+	}
+	if got := usage.Total().Calls; got != n {
+		t.Errorf("expected %d calls in the shared tracker, got %d", n, got)
+	}
+}
+
+// TestChatContextConcurrentUse shares one context between goroutines. Run with -race.
+func TestChatContextConcurrentUse(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{}`)
+	conv := newPrimedContext(WithProvider(fake))
+	store := NewJSONLStore(filepath.Join(t.TempDir(), "conversations.jsonl"))
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			conv.AddMessage(openai.UserMessage("question"))
+			if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); err != nil {
+				t.Errorf("GenerateResponseFromModelContext: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := conv.Save(context.Background(), store); err != nil {
+				t.Errorf("Save: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_ = conv.Snapshot().Tokens()
+			_ = conv.TotalUsage()
+			_ = conv.Fork()
+		}()
+	}
+	wg.Wait()
+
+	if got := len(conv.Snapshot().Messages); got != 3+2*n {
+		t.Errorf("expected every question and reply in memory, got %d messages", got)
+	}
+	if got := conv.TotalUsage().Calls; got != n {
+		t.Errorf("expected %d calls, got %d", n, got)
+	}
+}
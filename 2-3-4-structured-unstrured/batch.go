@@ -0,0 +1,55 @@
+package structuredoutput
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultBatchWorkers is the number of jobs RunBatch runs at once when no
+// worker count is given.
+const DefaultBatchWorkers = 4
+
+// BatchResult is the outcome of one item of RunBatch.
+type BatchResult[R any] struct {
+	Value   R
+	Err     error
+	Elapsed time.Duration
+}
+
+// RunBatch runs job for every item on a pool of workers goroutines and returns
+// the results in the order of items. Items not started when ctx is done fail
+// with its error.
+//
+// The jobs' conversations pace their model calls with a RateLimiter shared
+// through WithRateLimiter.
+func RunBatch[I, R any](ctx context.Context, items []I, workers int, job func(context.Context, I) (R, error)) []BatchResult[R] {
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	results := make([]BatchResult[R], len(items))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(workers, len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				start := time.Now()
+				value, err := job(ctx, items[i])
+				results[i] = BatchResult[R]{Value: value, Err: err, Elapsed: time.Since(start)}
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
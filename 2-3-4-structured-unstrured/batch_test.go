@@ -0,0 +1,91 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func TestRunBatch(t *testing.T) {
+	var running, peak atomic.Int32
+	items := []int{5, 1, 4, 2, 3, 0, 6, 7}
+	results := RunBatch(context.Background(), items, 3, func(ctx context.Context, n int) (string, error) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		// Later items finish first to check the order of the results.
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		if n == 0 {
+			return "", errors.New("zero")
+		}
+		return fmt.Sprint(n), nil
+	})
+
+	if len(results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(results))
+	}
+	for i, r := range results {
+		if items[i] == 0 {
+			if r.Err == nil {
+				t.Errorf("expected the error of item %d", i)
+			}
+			continue
+		}
+		if r.Err != nil || r.Value != fmt.Sprint(items[i]) {
+			t.Errorf("result %d: expected %d, got %q (%v)", i, items[i], r.Value, r.Err)
+		}
+	}
+	if got := peak.Load(); got > 3 {
+		t.Errorf("expected at most 3 jobs at once, got %d", got)
+	}
+}
+
+func TestRunBatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := RunBatch(ctx, []int{1, 2, 3}, 1, func(ctx context.Context, n int) (int, error) {
+		cancel()
+		return n, nil
+	})
+	if results[0].Err != nil || results[0].Value != 1 {
+		t.Errorf("expected the first job to finish, got %+v", results[0])
+	}
+	for _, r := range results[1:] {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("expected the later jobs to be canceled, got %+v", r)
+		}
+	}
+}
+
+// TestRunBatchConversations answers questions concurrently within a shared
+// rate limit. Run with -race.
+func TestRunBatchConversations(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{}`)
+	limiter := NewRateLimiter(0, 0)
+	usage := NewUsageTracker()
+	primed := newPrimedContext(WithProvider(fake), WithRateLimiter(limiter), WithUsage(usage))
+
+	questions := []string{"a", "b", "c", "d", "e", "f"}
+	results := RunBatch(context.Background(), questions, 4, func(ctx context.Context, q string) (Completion, error) {
+		conv := primed.Fork()
+		conv.AddMessage(openai.UserMessage(q))
+		return conv.GenerateResponseFromModelContext(ctx, testSchema)
+	})
+	for i, r := range results {
+		if r.Err != nil {
+			t.Errorf("question %d: %v", i, r.Err)
+		}
+	}
+	if got := usage.Total().Calls; got != len(questions) {
+		t.Errorf("expected %d calls, got %d", len(questions), got)
+	}
+}
@@ -0,0 +1,205 @@
+package structuredoutput
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// ResponseCache keeps completions by CacheKey so identical requests are not
+// sent to the model twice. Implementations are safe for concurrent use.
+type ResponseCache interface {
+	// Get returns the completion stored under key and false when there is none
+	// or it expired.
+	Get(ctx context.Context, key string) (*openai.ChatCompletion, bool, error)
+	// Set stores completion under key for ttl, or without expiry when ttl is zero.
+	Set(ctx context.Context, key string, completion *openai.ChatCompletion, ttl time.Duration) error
+}
+
+// CacheKey returns a stable hex digest of everything that shapes a request's
+// answer: the messages, response schema, model, tools and sampling params.
+func CacheKey(params openai.ChatCompletionNewParams) (string, error) {
+	// The params marshal in field order and maps, e.g. schemas, with sorted
+	// keys, so equal requests encode equally.
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("error hashing request: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func encodeCompletion(completion *openai.ChatCompletion) ([]byte, error) {
+	if raw := completion.RawJSON(); raw != "" {
+		return []byte(raw), nil
+	}
+	return json.Marshal(completion)
+}
+
+func decodeCompletion(data []byte) (*openai.ChatCompletion, error) {
+	var completion openai.ChatCompletion
+	if err := json.Unmarshal(data, &completion); err != nil {
+		return nil, err
+	}
+	return &completion, nil
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// LRUCache is an in-memory ResponseCache holding the most recently used completions.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewLRUCache keeps up to size completions.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) (*openai.ChatCompletion, bool, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false, nil
+	}
+	entry := e.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		c.mu.Unlock()
+		return nil, false, nil
+	}
+	c.order.MoveToFront(e)
+	c.mu.Unlock()
+
+	completion, err := decodeCompletion(entry.data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached response: %w", err)
+	}
+	return completion, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, completion *openai.ChatCompletion, ttl time.Duration) error {
+	data, err := encodeCompletion(completion)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &lruEntry{key: key, data: data, expiresAt: expiry(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of cached completions.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// SQLiteCache is a ResponseCache on disk, so runs share their completions.
+type SQLiteCache struct {
+	db *sql.DB
+}
+
+// NewSQLiteCache opens (or creates) the database at path and its responses table.
+func NewSQLiteCache(path string) (*SQLiteCache, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open response cache: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS responses (
+		key TEXT PRIMARY KEY,
+		completion TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create responses table: %w", err)
+	}
+	return &SQLiteCache{db: db}, nil
+}
+
+func (c *SQLiteCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *SQLiteCache) Get(ctx context.Context, key string) (*openai.ChatCompletion, bool, error) {
+	var data string
+	var expiresAt sql.NullTime
+	err := c.db.QueryRowContext(ctx, `SELECT completion, expires_at FROM responses WHERE key = ?`, key).Scan(&data, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response cache: %w", err)
+	}
+	if expiresAt.Valid && time.Now().After(expiresAt.Time) {
+		if _, err := c.db.ExecContext(ctx, `DELETE FROM responses WHERE key = ?`, key); err != nil {
+			return nil, false, fmt.Errorf("failed to expire cached response: %w", err)
+		}
+		return nil, false, nil
+	}
+
+	completion, err := decodeCompletion([]byte(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached response: %w", err)
+	}
+	return completion, true, nil
+}
+
+func (c *SQLiteCache) Set(ctx context.Context, key string, completion *openai.ChatCompletion, ttl time.Duration) error {
+	data, err := encodeCompletion(completion)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+	var expiresAt sql.NullTime
+	if ttl > 0 {
+		expiresAt = sql.NullTime{Time: expiry(ttl).UTC(), Valid: true}
+	}
+	_, err = c.db.ExecContext(ctx,
+		`INSERT INTO responses (key, completion, created_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET completion = excluded.completion, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		key, string(data), time.Now().UTC(), expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to write response cache: %w", err)
+	}
+	return nil
+}
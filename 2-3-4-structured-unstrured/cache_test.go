@@ -0,0 +1,194 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func testCaches(t *testing.T) map[string]ResponseCache {
+	t.Helper()
+	sqlite, err := NewSQLiteCache(filepath.Join(t.TempDir(), "responses.sqlite"))
+	if err != nil {
+		t.Fatalf("NewSQLiteCache: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]ResponseCache{"lru": NewLRUCache(10), "sqlite": sqlite}
+}
+
+func TestCacheKey(t *testing.T) {
+	conv := newPrimedContext()
+	params := conv.newParams(testSchema)
+	key, err := CacheKey(params)
+	if err != nil {
+		t.Fatalf("CacheKey: %v", err)
+	}
+	if again, _ := CacheKey(conv.newParams(testSchema)); again != key {
+		t.Errorf("expected equal requests to share a key")
+	}
+
+	changes := map[string]func(*openai.ChatCompletionNewParams){
+		"model":       func(p *openai.ChatCompletionNewParams) { p.Model = "gpt-4o-mini" },
+		"temperature": func(p *openai.ChatCompletionNewParams) { p.Temperature = openai.Float(0.7) },
+		"seed":        func(p *openai.ChatCompletionNewParams) { p.Seed = openai.Int(1) },
+		"message":     func(p *openai.ChatCompletionNewParams) { p.Messages = p.Messages[:2] },
+		"schema": func(p *openai.ChatCompletionNewParams) {
+			schema := testSchema
+			schema.Schema = map[string]any{"type": "object", "required": []string{"a"}}
+			p.ResponseFormat.OfJSONSchema = &openai.ResponseFormatJSONSchemaParam{JSONSchema: schema}
+		},
+	}
+	for name, change := range changes {
+		changed := conv.newParams(testSchema)
+		change(&changed)
+		if other, _ := CacheKey(changed); other == key {
+			t.Errorf("expected a different key after changing the %s", name)
+		}
+	}
+}
+
+func TestChatContextCache(t *testing.T) {
+	ctx := context.Background()
+	for name, cache := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			fake := NewFakeProvider().OnSchema("Answer", `{"n":1}`, `{"n":2}`)
+			ask := func(opts ...Option) (Completion, *ChatContext) {
+				conv := newPrimedContext(append([]Option{WithProvider(fake), WithCache(cache, 0)}, opts...)...)
+				conv.AddMessage(openai.UserMessage("question"))
+				completion, err := conv.GenerateResponseFromModelContext(ctx, testSchema)
+				if err != nil {
+					t.Fatalf("GenerateResponseFromModelContext: %v", err)
+				}
+				return completion, conv
+			}
+
+			first, _ := ask()
+			second, conv := ask()
+			if second.Content != first.Content || len(fake.Calls()) != 1 {
+				t.Errorf("expected the second answer from the cache, got %q after %d calls", second.Content, len(fake.Calls()))
+			}
+			if !conv.Calls[0].Cached || conv.TotalUsage() != (Usage{}) || second.Model != "fake" {
+				t.Errorf("expected a cached call without usage, got %+v", conv.Calls)
+			}
+			if len(conv.Memory.Messages) != 5 {
+				t.Errorf("expected the cached answer in the conversation, got %d messages", len(conv.Memory.Messages))
+			}
+
+			refreshed, _ := ask(WithCacheBypass())
+			if refreshed.Content != `{"n":2}` || len(fake.Calls()) != 2 {
+				t.Errorf("expected the bypass to ask the model, got %q", refreshed.Content)
+			}
+			if again, _ := ask(); again.Content != `{"n":2}` {
+				t.Errorf("expected the bypass to refresh the cache, got %q", again.Content)
+			}
+
+			conv = newPrimedContext(WithProvider(fake), WithCache(cache, 0))
+			conv.AddMessage(openai.UserMessage("question"))
+			stream := conv.GenerateResponseFromModelStream(ctx, testSchema)
+			var streamed string
+			for event := range stream.Events() {
+				streamed += event.Delta
+			}
+			if _, err := stream.Wait(); err != nil || streamed != `{"n":2}` || len(fake.Calls()) != 2 {
+				t.Errorf("expected the cached answer to be streamed, got %q (%v)", streamed, err)
+			}
+		})
+	}
+}
+
+// failingCache stores nothing and fails every write.
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) (*openai.ChatCompletion, bool, error) {
+	return nil, false, nil
+}
+func (failingCache) Set(context.Context, string, *openai.ChatCompletion, time.Duration) error {
+	return errors.New("disk full")
+}
+
+func TestChatContextCacheSkipsIncompleteAnswers(t *testing.T) {
+	ctx := context.Background()
+	for name, response := range map[string]FakeResponse{
+		"refusal":   {Refusal: "I can't help with that."},
+		"truncated": {Content: `{"n":`, FinishReason: "length"},
+		"filtered":  {Content: `{}`, FinishReason: "content_filter"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fake := NewFakeProvider().On("Answer", "", response)
+			cache := NewLRUCache(10)
+			conv := NewChatContext(1, WithProvider(fake), WithCache(cache, 0))
+			conv.AddMessage(openai.UserMessage("question"))
+			if _, err := conv.GenerateResponseFromModelContext(ctx, testSchema); err != nil {
+				t.Fatalf("GenerateResponseFromModelContext: %v", err)
+			}
+			if cache.Len() != 0 {
+				t.Errorf("expected the %s not to be cached", name)
+			}
+		})
+	}
+}
+
+func TestChatContextCacheWriteError(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{"n":1}`)
+	conv := NewChatContext(1, WithProvider(fake), WithCache(failingCache{}, 0))
+	conv.AddMessage(openai.UserMessage("question"))
+
+	completion, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	if err != nil || completion.Content != `{"n":1}` {
+		t.Fatalf("expected the answer despite the cache error, got %q (%v)", completion.Content, err)
+	}
+	if len(conv.Calls) != 1 || conv.TotalUsage().Calls != 1 {
+		t.Errorf("expected the call's usage to be kept, got %+v", conv.Calls)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	completion, err := fakeCompletion("fake", FakeResponse{Content: `{}`}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, cache := range testCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := cache.Set(ctx, "short", completion, time.Millisecond); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if err := cache.Set(ctx, "forever", completion, 0); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			time.Sleep(5 * time.Millisecond)
+
+			if _, ok, err := cache.Get(ctx, "short"); ok || err != nil {
+				t.Errorf("expected the entry to expire, got %v %v", ok, err)
+			}
+			got, ok, err := cache.Get(ctx, "forever")
+			if !ok || err != nil || got.Choices[0].Message.Content != `{}` {
+				t.Errorf("expected the entry without ttl, got %v %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestLRUCacheEvicts(t *testing.T) {
+	ctx := context.Background()
+	completion, err := fakeCompletion("fake", FakeResponse{Content: `{}`}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewLRUCache(2)
+	cache.Set(ctx, "a", completion, 0)
+	cache.Set(ctx, "b", completion, 0)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", completion, 0)
+
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); !ok || cache.Len() != 2 {
+		t.Errorf("expected a and c to stay, got %d entries", cache.Len())
+	}
+}
@@ -0,0 +1,84 @@
+package structuredoutput
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/openai/openai-go"
+)
+
+// CompletionChoice is one reply of the model.
+type CompletionChoice struct {
+	Content string `json:"content"`
+	Refusal string `json:"refusal,omitempty"`
+	// FinishReason is why the model stopped, e.g. "stop", "length" or "tool_calls".
+	FinishReason string `json:"finishReason"`
+	// ToolCalls are the tools the model asked for when no ToolRegistry ran them.
+	ToolCalls []ToolCallRecord `json:"toolCalls,omitempty"`
+}
+
+// Completion is the model's answer to a conversation. It embeds the first
+// choice, which is the one added to the conversation.
+type Completion struct {
+	CompletionChoice
+	// Alternatives are the other choices when the provider returned several.
+	Alternatives []CompletionChoice `json:"alternatives,omitempty"`
+	// Model is the model that answered, as reported by the provider.
+	Model string `json:"model"`
+	// Usage sums the model calls of the answer, including tool rounds.
+	Usage Usage `json:"usage"`
+}
+
+func newCompletionChoice(choice openai.ChatCompletionChoice) CompletionChoice {
+	msg := choice.Message
+	c := CompletionChoice{Content: msg.Content, Refusal: msg.Refusal, FinishReason: choice.FinishReason}
+	for _, call := range msg.ToolCalls {
+		c.ToolCalls = append(c.ToolCalls, ToolCallRecord{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return c
+}
+
+// newCompletion converts resp, the last of calls, into a Completion.
+func newCompletion(resp *openai.ChatCompletion, calls []CallUsage) Completion {
+	c := Completion{CompletionChoice: newCompletionChoice(resp.Choices[0])}
+	for _, choice := range resp.Choices[1:] {
+		c.Alternatives = append(c.Alternatives, newCompletionChoice(choice))
+	}
+	for _, call := range calls {
+		c.Model = call.Model
+		c.Usage = c.Usage.Add(call.Usage)
+	}
+	return c
+}
+
+// Err reports a refusal as *RefusalError and an answer that was cut short as
+// *TruncatedError. It is nil for a complete answer.
+func (c CompletionChoice) Err() error {
+	if c.Refusal != "" {
+		return &RefusalError{Refusal: c.Refusal}
+	}
+	switch c.FinishReason {
+	case "length":
+		return &TruncatedError{FinishReason: c.FinishReason, Content: c.Content}
+	case "content_filter":
+		return &RefusalError{Refusal: "response blocked by content filter"}
+	}
+	return nil
+}
+
+// decode checks the choice with Err and decodes its content strictly into out.
+func (c CompletionChoice) decode(schema string, out any) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(c.Content)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		return &SchemaMismatchError{Schema: schema, Content: c.Content, Err: err}
+	}
+	if dec.More() {
+		return &SchemaMismatchError{Schema: schema, Content: c.Content, Err: fmt.Errorf("unexpected data after JSON value")}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package structuredoutput
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+)
+
+// FakeResponse is a canned model reply served by FakeProvider.
+type FakeResponse struct {
+	Content string
+	Refusal string
+	// ToolCalls are the tools the reply calls.
+	ToolCalls []FakeToolCall
+	// FinishReason defaults to "tool_calls" with ToolCalls and "stop" otherwise.
+	FinishReason string
+	// Err, when set, is returned instead of a completion.
+	Err error
+}
+
+// FakeToolCall is a tool call in a FakeResponse.
+type FakeToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+type fakeKey struct {
+	schema string
+	prompt string
+}
+
+// FakeProvider is a deterministic in-process Provider for tests.
+// Responses are looked up by response schema name and prompt hash; a script
+// registered with an empty prompt hash answers any prompt for that schema.
+// When a script holds several responses they are served in order and the
+// last one is repeated.
+type FakeProvider struct {
+	mu      sync.Mutex
+	scripts map[fakeKey][]FakeResponse
+	calls   []openai.ChatCompletionNewParams
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{scripts: map[fakeKey][]FakeResponse{}}
+}
+
+func (f *FakeProvider) Name() string  { return "fake" }
+func (f *FakeProvider) Model() string { return "fake" }
+
+// On scripts the responses for a schema name and prompt hash (see PromptHash).
+// An empty promptHash matches every prompt sent with that schema.
+func (f *FakeProvider) On(schemaName string, promptHash string, responses ...FakeResponse) *FakeProvider {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeKey{schemaName, promptHash}
+	f.scripts[key] = append(f.scripts[key], responses...)
+	return f
+}
+
+// OnSchema scripts plain content responses for any prompt sent with schemaName.
+func (f *FakeProvider) OnSchema(schemaName string, contents ...string) *FakeProvider {
+	responses := make([]FakeResponse, len(contents))
+	for i, content := range contents {
+		responses[i] = FakeResponse{Content: content}
+	}
+	return f.On(schemaName, "", responses...)
+}
+
+// Calls returns the requests the provider has received so far.
+func (f *FakeProvider) Calls() []openai.ChatCompletionNewParams {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]openai.ChatCompletionNewParams(nil), f.calls...)
+}
+
+func (f *FakeProvider) ChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	schema := SchemaName(params)
+	hash, err := PromptHash(params.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, params)
+
+	key := fakeKey{schema, hash}
+	queue, ok := f.scripts[key]
+	if !ok {
+		key = fakeKey{schema, ""}
+		queue, ok = f.scripts[key]
+	}
+	if !ok || len(queue) == 0 {
+		return nil, fmt.Errorf("fake provider: no response scripted for schema %q and prompt %s", schema, hash)
+	}
+
+	next := queue[0]
+	if len(queue) > 1 {
+		f.scripts[key] = queue[1:]
+	}
+	if next.Err != nil {
+		return nil, next.Err
+	}
+	return fakeCompletion(f.Model(), next, Memory{Messages: params.Messages}.Tokens())
+}
+
+// fakeChunkSize is the number of bytes in each delta FakeProvider streams.
+const fakeChunkSize = 8
+
+// ChatCompletionStream serves the scripted completion in pieces of fakeChunkSize bytes.
+func (f *FakeProvider) ChatCompletionStream(ctx context.Context, params openai.ChatCompletionNewParams, onDelta func(string)) (*openai.ChatCompletion, error) {
+	resp, err := f.ChatCompletion(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	content := resp.Choices[0].Message.Content
+	for start := 0; start < len(content); {
+		end := start + fakeChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		// Do not split a UTF-8 sequence.
+		for end < len(content) && !utf8.RuneStart(content[end]) {
+			end++
+		}
+		onDelta(content[start:end])
+		start = end
+	}
+	return resp, nil
+}
+
+// fakeCompletion builds the completion for r. Its usage is estimated with
+// CountTokens from the promptTokens of the request and the content of r.
+func fakeCompletion(model string, r FakeResponse, promptTokens int) (*openai.ChatCompletion, error) {
+	finishReason := r.FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+		if len(r.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+	}
+
+	message := map[string]any{
+		"role":    "assistant",
+		"content": r.Content,
+		"refusal": r.Refusal,
+	}
+	completionTokens := CountTokens(r.Content)
+	if len(r.ToolCalls) > 0 {
+		calls := make([]map[string]any, len(r.ToolCalls))
+		for i, call := range r.ToolCalls {
+			calls[i] = map[string]any{
+				"id":       call.ID,
+				"type":     "function",
+				"function": map[string]any{"name": call.Name, "arguments": call.Arguments},
+			}
+		}
+		message["tool_calls"] = calls
+	}
+
+	raw, err := json.Marshal(map[string]any{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"created": 0,
+		"model":   model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"finish_reason": finishReason,
+			"message":       message,
+		}},
+		"usage": map[string]any{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var completion openai.ChatCompletion
+	if err := json.Unmarshal(raw, &completion); err != nil {
+		return nil, err
+	}
+	return &completion, nil
+}
+
+// SchemaName returns the JSON-schema response format name of a request, if any.
+func SchemaName(params openai.ChatCompletionNewParams) string {
+	if params.ResponseFormat.OfJSONSchema == nil {
+		return ""
+	}
+	return params.ResponseFormat.OfJSONSchema.JSONSchema.Name
+}
+
+// PromptHash returns a stable hex digest of a conversation's messages.
+func PromptHash(messages []openai.ChatCompletionMessageParamUnion) (string, error) {
+	raw, err := json.Marshal(messages)
+	if err != nil {
+		return "", fmt.Errorf("error hashing prompt: %w", err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GoldenProvider replays completions from golden files in a directory.
+// When it wraps an upstream Provider it records instead: every request is
+// forwarded upstream and the completion is written to the directory.
+type GoldenProvider struct {
+	dir      string
+	upstream Provider
+}
+
+// NewGoldenProvider returns a replaying GoldenProvider when upstream is nil
+// and a recording one otherwise.
+func NewGoldenProvider(dir string, upstream Provider) *GoldenProvider {
+	return &GoldenProvider{dir: dir, upstream: upstream}
+}
+
+// GoldenProviderFromEnv replays from dir unless LLMDOJO_RECORD is set, in which
+// case it records responses from the provider configured by the environment.
+func GoldenProviderFromEnv(dir string) (*GoldenProvider, error) {
+	if os.Getenv("LLMDOJO_RECORD") == "" {
+		return NewGoldenProvider(dir, nil), nil
+	}
+	upstream, err := NewProviderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewGoldenProvider(dir, upstream), nil
+}
+
+func (g *GoldenProvider) Name() string { return "golden" }
+
+func (g *GoldenProvider) Model() string {
+	if g.upstream != nil {
+		return g.upstream.Model()
+	}
+	return "golden"
+}
+
+// Recording reports whether the provider writes golden files.
+func (g *GoldenProvider) Recording() bool {
+	return g.upstream != nil
+}
+
+func (g *GoldenProvider) ChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	hash, err := PromptHash(params.Messages)
+	if err != nil {
+		return nil, err
+	}
+	path := g.path(SchemaName(params), hash)
+
+	if g.upstream == nil {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("golden provider: no recording for request: %w", err)
+		}
+		var completion openai.ChatCompletion
+		if err := json.Unmarshal(raw, &completion); err != nil {
+			return nil, fmt.Errorf("golden provider: error decoding %s: %w", path, err)
+		}
+		return &completion, nil
+	}
+
+	completion, err := g.upstream.ChatCompletion(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(g.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("golden provider: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(completion.RawJSON()), 0o644); err != nil {
+		return nil, fmt.Errorf("golden provider: error writing %s: %w", path, err)
+	}
+	return completion, nil
+}
+
+func (g *GoldenProvider) path(schema string, hash string) string {
+	if schema == "" {
+		schema = "text"
+	}
+	return filepath.Join(g.dir, fmt.Sprintf("%s-%s.json", schema, hash[:16]))
+}
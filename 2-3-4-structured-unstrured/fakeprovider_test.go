@@ -0,0 +1,88 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+func fakeRequest(schema string, prompt string) openai.ChatCompletionNewParams {
+	return openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(prompt)},
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{Name: schema},
+			},
+		},
+	}
+}
+
+func TestFakeProviderScripts(t *testing.T) {
+	req := fakeRequest("Answer", "what is 2+2?")
+	hash, err := PromptHash(req.Messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := NewFakeProvider().
+		OnSchema("Answer", `{"n":0}`).
+		On("Answer", hash, FakeResponse{Content: `{"n":3}`}, FakeResponse{Content: `{"n":4}`})
+
+	for _, want := range []string{`{"n":3}`, `{"n":4}`, `{"n":4}`} {
+		got, err := fake.ChatCompletion(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ChatCompletion: %v", err)
+		}
+		if got.Choices[0].Message.Content != want {
+			t.Errorf("expected %s, got %s", want, got.Choices[0].Message.Content)
+		}
+	}
+
+	got, err := fake.ChatCompletion(context.Background(), fakeRequest("Answer", "something else"))
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if got.Choices[0].Message.Content != `{"n":0}` {
+		t.Errorf("expected schema fallback, got %s", got.Choices[0].Message.Content)
+	}
+
+	if _, err := fake.ChatCompletion(context.Background(), fakeRequest("Other", "x")); err == nil {
+		t.Error("expected error for unscripted schema")
+	}
+	if len(fake.Calls()) != 5 {
+		t.Errorf("expected 5 recorded calls, got %d", len(fake.Calls()))
+	}
+}
+
+func TestFakeProviderError(t *testing.T) {
+	boom := errors.New("boom")
+	fake := NewFakeProvider().On("Answer", "", FakeResponse{Err: boom})
+	if _, err := fake.ChatCompletion(context.Background(), fakeRequest("Answer", "x")); !errors.Is(err, boom) {
+		t.Fatalf("expected scripted error, got %v", err)
+	}
+}
+
+func TestGoldenProviderRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	req := fakeRequest("Answer", "what is 2+2?")
+
+	upstream := NewFakeProvider().OnSchema("Answer", `{"n":4}`)
+	if _, err := NewGoldenProvider(dir, upstream).ChatCompletion(context.Background(), req); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	got, err := NewGoldenProvider(dir, nil).ChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if got.Choices[0].Message.Content != `{"n":4}` {
+		t.Errorf("unexpected replayed content %s", got.Choices[0].Message.Content)
+	}
+
+	if _, err := NewGoldenProvider(dir, nil).ChatCompletion(context.Background(), fakeRequest("Answer", "new prompt")); err == nil {
+		t.Error("expected error for prompt without recording")
+	}
+}
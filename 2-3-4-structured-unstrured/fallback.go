@@ -0,0 +1,292 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// ErrorClass groups the ways a model call fails, for FallbackRules.
+type ErrorClass string
+
+const (
+	// ErrorTimeout is a call that ran out of its FallbackTarget.Timeout.
+	ErrorTimeout ErrorClass = "timeout"
+	// ErrorServer is a 5xx response or a backend that cannot be reached.
+	ErrorServer ErrorClass = "server"
+	// ErrorRateLimit is a 429 Too Many Requests response.
+	ErrorRateLimit ErrorClass = "rate_limit"
+	// ErrorRefusal is a completion in which the model refused to answer.
+	ErrorRefusal ErrorClass = "refusal"
+	// ErrorOther is any other error, e.g. a request the backend rejected.
+	ErrorOther ErrorClass = "other"
+)
+
+// ClassifyError returns the ErrorClass of an error returned by a Provider.
+func ClassifyError(err error) ErrorClass {
+	var apiErr *openai.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorRateLimit
+		case apiErr.StatusCode == http.StatusRequestTimeout:
+			return ErrorTimeout
+		case apiErr.StatusCode >= 500:
+			return ErrorServer
+		}
+		return ErrorOther
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorServer
+	}
+	return ErrorOther
+}
+
+// FallbackRules tell for every ErrorClass whether a FallbackProvider moves on
+// to the next target. Classes not listed end the call with the error.
+type FallbackRules map[ErrorClass]bool
+
+// DefaultFallbackRules fall back on timeouts, server errors, rate limits and refusals.
+var DefaultFallbackRules = FallbackRules{
+	ErrorTimeout:   true,
+	ErrorServer:    true,
+	ErrorRateLimit: true,
+	ErrorRefusal:   true,
+}
+
+// ErrCircuitOpen is returned by a FallbackProvider whose targets are all
+// paused by their circuit breaker.
+var ErrCircuitOpen = errors.New("circuit open")
+
+const (
+	// DefaultBreakerThreshold is the number of failures in a row that open a target's circuit.
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is how long an open circuit skips its target.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// FallbackTarget is one provider/model pair of a FallbackProvider.
+type FallbackTarget struct {
+	Provider Provider
+	// Model overrides the Provider's model when set.
+	Model string
+	// Timeout bounds a call to this target, leaving the rest of the caller's
+	// deadline to the next ones. Zero leaves it to the caller's context.
+	Timeout time.Duration
+}
+
+func (t FallbackTarget) model() string {
+	if t.Model != "" {
+		return t.Model
+	}
+	return t.Provider.Model()
+}
+
+func (t FallbackTarget) String() string {
+	return t.Provider.Name() + "/" + t.model()
+}
+
+// FallbackStats are the metrics of one FallbackTarget.
+type FallbackStats struct {
+	Target string `json:"target"`
+	// Served counts the calls the target answered.
+	Served   int                `json:"served"`
+	Failures map[ErrorClass]int `json:"failures"`
+	// Skipped counts the calls passed on while the circuit was open.
+	Skipped int  `json:"skipped"`
+	Open    bool `json:"open"`
+}
+
+// FallbackProvider is a Provider that tries an ordered chain of provider/model
+// pairs: when a target fails with an error class its Rules fall back on, the
+// request goes to the next one. A circuit breaker skips a target for Cooldown
+// after Threshold failures in a row; then it is tried again, and another
+// failure opens it anew.
+//
+// The model of a request is replaced by each target's model, so the
+// conversation's Options.Model has no effect. The conversation's Timeout
+// bounds the whole chain; bound each target with FallbackTarget.Timeout.
+type FallbackProvider struct {
+	Rules     FallbackRules
+	Threshold int
+	Cooldown  time.Duration
+
+	targets []FallbackTarget
+	mu      sync.Mutex
+	state   []fallbackState
+}
+
+type fallbackState struct {
+	stats     FallbackStats
+	failures  int
+	openUntil time.Time
+}
+
+// NewFallbackProvider tries targets in order with the DefaultFallbackRules.
+func NewFallbackProvider(targets ...FallbackTarget) *FallbackProvider {
+	f := &FallbackProvider{
+		Rules:     DefaultFallbackRules,
+		Threshold: DefaultBreakerThreshold,
+		Cooldown:  DefaultBreakerCooldown,
+		targets:   targets,
+		state:     make([]fallbackState, len(targets)),
+	}
+	for i, t := range targets {
+		f.state[i].stats = FallbackStats{Target: t.String(), Failures: map[ErrorClass]int{}}
+	}
+	return f
+}
+
+func (f *FallbackProvider) Name() string { return "fallback" }
+
+// Model is the model of the first target.
+func (f *FallbackProvider) Model() string {
+	if len(f.targets) == 0 {
+		return ""
+	}
+	return f.targets[0].model()
+}
+
+func (f *FallbackProvider) ChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	return f.do(ctx, params, func(ctx context.Context, p Provider, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+		return p.ChatCompletion(ctx, params)
+	})
+}
+
+// ChatCompletionStream streams from the targets that can. Deltas of a target
+// that fails mid-answer have already been sent when the next one starts.
+func (f *FallbackProvider) ChatCompletionStream(ctx context.Context, params openai.ChatCompletionNewParams, onDelta func(string)) (*openai.ChatCompletion, error) {
+	return f.do(ctx, params, func(ctx context.Context, p Provider, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+		if sp, ok := p.(StreamingProvider); ok {
+			return sp.ChatCompletionStream(ctx, params, onDelta)
+		}
+		resp, err := p.ChatCompletion(ctx, params)
+		if err == nil && len(resp.Choices) > 0 && resp.Choices[0].Message.Content != "" {
+			onDelta(resp.Choices[0].Message.Content)
+		}
+		return resp, err
+	})
+}
+
+// Stats returns the metrics of the targets in chain order.
+func (f *FallbackProvider) Stats() []FallbackStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := make([]FallbackStats, len(f.state))
+	now := time.Now()
+	for i, s := range f.state {
+		stats[i] = s.stats
+		stats[i].Failures = make(map[ErrorClass]int, len(s.stats.Failures))
+		for class, n := range s.stats.Failures {
+			stats[i].Failures[class] = n
+		}
+		stats[i].Open = now.Before(s.openUntil)
+	}
+	return stats
+}
+
+type sendFunc func(ctx context.Context, p Provider, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error)
+
+func (f *FallbackProvider) do(ctx context.Context, params openai.ChatCompletionNewParams, send sendFunc) (*openai.ChatCompletion, error) {
+	var lastErr error
+	var refused *openai.ChatCompletion
+	refusedBy := -1
+	for i, target := range f.targets {
+		if !f.allow(i) {
+			continue
+		}
+		params.Model = target.model()
+		resp, err := f.try(ctx, target, params, send)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var class ErrorClass
+		switch {
+		case err != nil:
+			class = ClassifyError(err)
+		case len(resp.Choices) > 0 && resp.Choices[0].Message.Refusal != "":
+			class, refused, refusedBy = ErrorRefusal, resp, i
+			err = &RefusalError{Refusal: resp.Choices[0].Message.Refusal}
+		default:
+			f.record(i, "")
+			return resp, nil
+		}
+		if !f.Rules[class] {
+			if class == ErrorRefusal {
+				f.record(i, "")
+				return resp, nil
+			}
+			f.record(i, class)
+			return nil, err
+		}
+		f.record(i, class)
+		lastErr = fmt.Errorf("%s: %w", target, err)
+	}
+
+	// A refusal is an answer; the caller sees it in the Completion.
+	if refused != nil {
+		f.mu.Lock()
+		f.state[refusedBy].stats.Served++
+		f.mu.Unlock()
+		return refused, nil
+	}
+	if lastErr == nil {
+		return nil, fmt.Errorf("fallback provider: %w for all models", ErrCircuitOpen)
+	}
+	return nil, fmt.Errorf("fallback provider: all models failed, last: %w", lastErr)
+}
+
+// try calls target within its Timeout.
+func (f *FallbackProvider) try(ctx context.Context, target FallbackTarget, params openai.ChatCompletionNewParams, send sendFunc) (*openai.ChatCompletion, error) {
+	if target.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, target.Timeout)
+		defer cancel()
+	}
+	return send(ctx, target.Provider, params)
+}
+
+// allow reports whether the circuit of target i lets a call through.
+func (f *FallbackProvider) allow(i int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Now().Before(f.state[i].openUntil) {
+		f.state[i].stats.Skipped++
+		return false
+	}
+	return true
+}
+
+// record counts the outcome of a call to target i; an empty class is a success.
+// Only failures the rules fall back on count towards opening the circuit.
+func (f *FallbackProvider) record(i int, class ErrorClass) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := &f.state[i]
+	if class == "" {
+		s.stats.Served++
+		s.failures = 0
+		return
+	}
+	s.stats.Failures[class]++
+	if !f.Rules[class] || class == ErrorRefusal {
+		return
+	}
+	s.failures++
+	if f.Threshold > 0 && s.failures >= f.Threshold {
+		s.openUntil = time.Now().Add(f.Cooldown)
+	}
+}
@@ -0,0 +1,137 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func apiError(status int) error {
+	return &openai.Error{StatusCode: status, Response: &http.Response{StatusCode: status, Header: http.Header{}}}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{apiError(http.StatusTooManyRequests), ErrorRateLimit},
+		{apiError(http.StatusBadGateway), ErrorServer},
+		{apiError(http.StatusRequestTimeout), ErrorTimeout},
+		{apiError(http.StatusBadRequest), ErrorOther},
+		{fmt.Errorf("request: %w", context.DeadlineExceeded), ErrorTimeout},
+		{errors.New("boom"), ErrorOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v): expected %s, got %s", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestFallbackProvider(t *testing.T) {
+	primary := NewFakeProvider().On("Answer", "", FakeResponse{Err: apiError(http.StatusServiceUnavailable)})
+	backup := NewFakeProvider().OnSchema("Answer", `{}`)
+	fallback := NewFallbackProvider(
+		FallbackTarget{Provider: primary, Model: "gpt-4o"},
+		FallbackTarget{Provider: backup, Model: "gpt-4o-mini"},
+	)
+	conv := newPrimedContext(WithProvider(fallback))
+
+	if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); err != nil {
+		t.Fatalf("expected the backup to answer, got: %v", err)
+	}
+	if primary.Calls()[0].Model != "gpt-4o" || backup.Calls()[0].Model != "gpt-4o-mini" {
+		t.Errorf("expected each target's model, got %q and %q", primary.Calls()[0].Model, backup.Calls()[0].Model)
+	}
+	stats := fallback.Stats()
+	if stats[0].Failures[ErrorServer] != 1 || stats[0].Served != 0 || stats[1].Served != 1 || stats[1].Target != "fake/gpt-4o-mini" {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// A request the backend rejects is not sent to the next model.
+	primary = NewFakeProvider().On("Answer", "", FakeResponse{Err: apiError(http.StatusBadRequest)})
+	fallback = NewFallbackProvider(FallbackTarget{Provider: primary}, FallbackTarget{Provider: backup})
+	conv = newPrimedContext(WithProvider(fallback))
+	if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); ClassifyError(err) != ErrorOther {
+		t.Errorf("expected the bad request error, got: %v", err)
+	}
+	if len(backup.Calls()) != 1 {
+		t.Errorf("expected no call to the backup, got %d", len(backup.Calls())-1)
+	}
+}
+
+func TestFallbackProviderTimeoutAndRefusal(t *testing.T) {
+	refusing := NewFakeProvider().On("Answer", "", FakeResponse{Refusal: "I can't help with that."})
+	backup := NewFakeProvider().OnSchema("Answer", `{"ok":true}`)
+	fallback := NewFallbackProvider(
+		FallbackTarget{Provider: blockingProvider{}, Timeout: 20 * time.Millisecond},
+		FallbackTarget{Provider: refusing},
+		FallbackTarget{Provider: backup},
+	)
+	conv := newPrimedContext(WithProvider(fallback))
+
+	completion, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	if err != nil || completion.Content != `{"ok":true}` {
+		t.Fatalf("expected the backup's answer, got %q (%v)", completion.Content, err)
+	}
+	stats := fallback.Stats()
+	if stats[0].Failures[ErrorTimeout] != 1 || stats[1].Failures[ErrorRefusal] != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// Without another model the refusal is the answer.
+	fallback = NewFallbackProvider(FallbackTarget{Provider: refusing})
+	conv = newPrimedContext(WithProvider(fallback))
+	completion, err = conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	var refusal *RefusalError
+	if err != nil || !errors.As(completion.Err(), &refusal) {
+		t.Errorf("expected a refusal, got %+v (%v)", completion, err)
+	}
+	if fallback.Stats()[0].Served != 1 {
+		t.Errorf("expected the refusal to count as served, got: %+v", fallback.Stats())
+	}
+}
+
+func TestFallbackProviderCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	failing := NewFakeProvider().On("Answer", "", FakeResponse{Err: apiError(http.StatusInternalServerError)})
+	backup := NewFakeProvider().OnSchema("Answer", `{}`)
+	fallback := NewFallbackProvider(FallbackTarget{Provider: failing}, FallbackTarget{Provider: backup})
+	fallback.Threshold = 2
+	fallback.Cooldown = 50 * time.Millisecond
+	conv := newPrimedContext(WithProvider(fallback))
+
+	for range 3 {
+		if _, err := conv.GenerateResponseFromModelContext(ctx, testSchema); err != nil {
+			t.Fatalf("GenerateResponseFromModelContext: %v", err)
+		}
+	}
+	if len(failing.Calls()) != 2 {
+		t.Errorf("expected the open circuit to skip the failing model, got %d calls", len(failing.Calls()))
+	}
+	if stats := fallback.Stats(); !stats[0].Open || stats[0].Skipped != 1 || stats[1].Served != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	time.Sleep(fallback.Cooldown)
+	if _, err := conv.GenerateResponseFromModelContext(ctx, testSchema); err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+	if len(failing.Calls()) != 3 || !fallback.Stats()[0].Open {
+		t.Errorf("expected one trial after the cooldown that opens the circuit again, got %d calls", len(failing.Calls()))
+	}
+
+	alone := NewFallbackProvider(FallbackTarget{Provider: failing})
+	alone.Threshold = 1
+	conv = newPrimedContext(WithProvider(alone))
+	conv.GenerateResponseFromModelContext(ctx, testSchema)
+	if _, err := conv.GenerateResponseFromModelContext(ctx, testSchema); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/invopop/jsonschema"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// GenerateOptions describe the structured response requested by Generate.
+type GenerateOptions struct {
+	// Name of the response schema. Defaults to the Go type name of T.
+	Name        string
+	Description string
+	// MaxRetries is how many times the model is asked again after an answer
+	// that does not match the schema or fails validation.
+	MaxRetries int
+}
+
+// RefusalError is returned when the model declines to answer.
+type RefusalError struct {
+	Refusal string
+}
+
+func (e *RefusalError) Error() string {
+	return fmt.Sprintf("model refused to answer: %s", e.Refusal)
+}
+
+// TruncatedError is returned when the model stops before completing its answer.
+type TruncatedError struct {
+	FinishReason string
+	Content      string
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("model response truncated (finish reason %q)", e.FinishReason)
+}
+
+// SchemaMismatchError is returned when the model's answer does not decode into the requested type.
+type SchemaMismatchError struct {
+	Schema  string
+	Content string
+	Err     error
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("model response does not match schema %s: %v", e.Schema, e.Err)
+}
+
+func (e *SchemaMismatchError) Unwrap() error {
+	return e.Err
+}
+
+// GenerateSchema reflects T into a JSON schema suitable for strict structured outputs:
+// every field is required and no additional properties are allowed.
+func GenerateSchema[T any]() interface{} {
+
+	reflector := jsonschema.Reflector{
+		AllowAdditionalProperties: false,
+		DoNotReference:            true,
+	}
+	var v T
+	schema := reflector.Reflect(v)
+	return schema
+}
+
+var schemaNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// ResponseSchema builds a strict JSON-schema response format for T.
+// An empty name defaults to the Go type name of T.
+func ResponseSchema[T any](name string, description string) shared.ResponseFormatJSONSchemaJSONSchemaParam {
+	if name == "" {
+		name = schemaNameInvalid.ReplaceAllString(reflect.TypeFor[T]().Name(), "_")
+	}
+	if name == "" {
+		name = "Response"
+	}
+
+	schema := shared.ResponseFormatJSONSchemaJSONSchemaParam{
+		Name:   name,
+		Schema: GenerateSchema[T](),
+		Strict: openai.Bool(true),
+	}
+	if description != "" {
+		schema.Description = openai.String(description)
+	}
+	return schema
+}
+
+// Generate asks the model for a response shaped like T and decodes it.
+// The schema is derived from T and sent in strict mode. Refusals, truncated
+// answers and answers that do not decode into T are reported as
+// *RefusalError, *TruncatedError and *SchemaMismatchError.
+//
+// Decoded answers are checked by T's Validate method and the validators
+// registered with RegisterValidator; failures are reported as *ValidationError.
+// Schema and validation failures are fed back to the model as a follow-up
+// user message and retried up to opts.MaxRetries times.
+func Generate[T any](ctx context.Context, c *ChatContext, opts GenerateOptions) (T, error) {
+	return generate[T](ctx, c, opts, nil)
+}
+
+func generate[T any](ctx context.Context, c *ChatContext, opts GenerateOptions, sink *streamSink) (T, error) {
+	schema := ResponseSchema[T](opts.Name, opts.Description)
+
+	for attempt := 0; ; attempt++ {
+		var out T
+		completion, err := c.complete(ctx, schema, sink)
+		if err != nil {
+			return out, err
+		}
+
+		err = completion.decode(schema.Name, &out)
+		if err == nil {
+			if verr := validate(out); verr != nil {
+				err = &ValidationError{Schema: schema.Name, Err: verr}
+			}
+		}
+		if err == nil {
+			return out, nil
+		}
+		if !retryable(err) || attempt >= opts.MaxRetries {
+			return out, err
+		}
+
+		c.AddMessage(openai.UserMessage(fmt.Sprintf(
+			"Your previous response was invalid: %v. Respond again with a corrected answer that matches the %s schema.", err, schema.Name)))
+	}
+}
+
+// retryable reports whether asking the model again may fix err.
+func retryable(err error) bool {
+	var mismatch *SchemaMismatchError
+	var invalid *ValidationError
+	return errors.As(err, &mismatch) || errors.As(err, &invalid)
+}
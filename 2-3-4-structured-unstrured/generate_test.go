@@ -0,0 +1,71 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+type testAnswer struct {
+	Value int    `json:"value"`
+	Unit  string `json:"unit"`
+}
+
+func generateWith(t *testing.T, responses ...FakeResponse) (testAnswer, *FakeProvider, error) {
+	t.Helper()
+	fake := NewFakeProvider().On("testAnswer", "", responses...)
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("how far?"))
+	answer, err := Generate[testAnswer](context.Background(), conv, GenerateOptions{})
+	return answer, fake, err
+}
+
+func TestGenerate(t *testing.T) {
+	answer, fake, err := generateWith(t, FakeResponse{Content: `{"value":42,"unit":"km"}`})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if answer != (testAnswer{Value: 42, Unit: "km"}) {
+		t.Errorf("unexpected answer %+v", answer)
+	}
+
+	format := fake.Calls()[0].ResponseFormat.OfJSONSchema
+	if format == nil || !format.JSONSchema.Strict.Value {
+		t.Error("expected strict JSON schema response format")
+	}
+}
+
+func TestGenerateRefusal(t *testing.T) {
+	_, _, err := generateWith(t, FakeResponse{Refusal: "I can't help with that."})
+	var refusal *RefusalError
+	if !errors.As(err, &refusal) {
+		t.Fatalf("expected RefusalError, got %v", err)
+	}
+	if refusal.Refusal != "I can't help with that." {
+		t.Errorf("unexpected refusal %q", refusal.Refusal)
+	}
+}
+
+func TestGenerateTruncated(t *testing.T) {
+	_, _, err := generateWith(t, FakeResponse{Content: `{"value":4`, FinishReason: "length"})
+	var truncated *TruncatedError
+	if !errors.As(err, &truncated) {
+		t.Fatalf("expected TruncatedError, got %v", err)
+	}
+}
+
+func TestGenerateSchemaMismatch(t *testing.T) {
+	for _, content := range []string{
+		`{"value":"forty-two","unit":"km"}`,
+		`{"value":42,"unit":"km","extra":true}`,
+		`not json`,
+	} {
+		_, _, err := generateWith(t, FakeResponse{Content: content})
+		var mismatch *SchemaMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Errorf("%s: expected SchemaMismatchError, got %v", content, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package structuredoutput
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// storedConversation is one line of a JSONLStore file.
+type storedConversation struct {
+	Id        int             `json:"id"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	Messages  []MessageRecord `json:"messages"`
+}
+
+// JSONLStore is a MemoryStore keeping one conversation per line in a file.
+// Every change rewrites the file through a temporary file, so it suits the
+// dozens of conversations of an interactive session rather than a server.
+type JSONLStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewJSONLStore returns a store backed by path. The file is created on the first Save.
+func NewJSONLStore(path string) *JSONLStore {
+	return &JSONLStore{path: path}
+}
+
+func (s *JSONLStore) Save(ctx context.Context, id int, memory Memory) error {
+	records, err := memory.Records()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversations, err := s.read()
+	if err != nil {
+		return err
+	}
+	conversations[id] = storedConversation{Id: id, UpdatedAt: time.Now().UTC(), Messages: records}
+	return s.write(conversations)
+}
+
+func (s *JSONLStore) Load(ctx context.Context, id int) (Memory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversations, err := s.read()
+	if err != nil {
+		return Memory{}, err
+	}
+	conv, ok := conversations[id]
+	if !ok {
+		return Memory{}, fmt.Errorf("%w: %d", ErrConversationNotFound, id)
+	}
+	return MemoryFromRecords(conv.Messages)
+}
+
+func (s *JSONLStore) List(ctx context.Context) ([]ConversationInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversations, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ConversationInfo, 0, len(conversations))
+	for _, conv := range conversations {
+		infos = append(infos, ConversationInfo{Id: conv.Id, Messages: len(conv.Messages), UpdatedAt: conv.UpdatedAt})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Id < infos[j].Id })
+	return infos, nil
+}
+
+func (s *JSONLStore) Delete(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversations, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := conversations[id]; !ok {
+		return fmt.Errorf("%w: %d", ErrConversationNotFound, id)
+	}
+	delete(conversations, id)
+	return s.write(conversations)
+}
+
+func (s *JSONLStore) read() (map[int]storedConversation, error) {
+	conversations := map[int]storedConversation{}
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return conversations, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open conversation store: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var conv storedConversation
+		if err := json.Unmarshal(scanner.Bytes(), &conv); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		conversations[conv.Id] = conv
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read conversation store: %w", err)
+	}
+	return conversations, nil
+}
+
+func (s *JSONLStore) write(conversations map[int]storedConversation) error {
+	ids := make([]int, 0, len(conversations))
+	for id := range conversations {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write conversation store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, id := range ids {
+		if err := enc.Encode(conversations[id]); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to encode conversation %d: %w", id, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write conversation store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write conversation store: %w", err)
+	}
+	// CreateTemp makes the file 0600; keep the mode of the store it replaces.
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(s.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write conversation store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace conversation store: %w", err)
+	}
+	return nil
+}
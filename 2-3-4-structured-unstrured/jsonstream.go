@@ -0,0 +1,155 @@
+package structuredoutput
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// FieldEvent reports a JSON value that has been received completely.
+type FieldEvent struct {
+	// Path locates the value, e.g. "steps[0].explanation" or "finalOutput".
+	Path  string
+	Value json.RawMessage
+}
+
+// Text returns a string value decoded and any other value as raw JSON.
+func (e FieldEvent) Text() string {
+	var s string
+	if json.Unmarshal(e.Value, &s) == nil {
+		return s
+	}
+	return string(e.Value)
+}
+
+// JSONStreamParser follows a JSON document as it arrives in pieces and reports
+// every value below the root as soon as it is complete: the fields of an
+// object in order, then the object itself. It does not validate the JSON;
+// the complete answer is still decoded and checked by Generate.
+type JSONStreamParser struct {
+	buf   []byte
+	pos   int
+	stack []jsonFrame
+
+	inString   bool
+	escaped    bool
+	inLiteral  bool
+	isKey      bool
+	valueStart int
+}
+
+type jsonFrame struct {
+	array     bool
+	start     int
+	key       string
+	index     int
+	expectKey bool
+}
+
+func NewJSONStreamParser() *JSONStreamParser {
+	return &JSONStreamParser{}
+}
+
+// Feed adds the next piece of the document and returns the values it completed.
+func (p *JSONStreamParser) Feed(delta string) []FieldEvent {
+	p.buf = append(p.buf, delta...)
+	var events []FieldEvent
+	for ; p.pos < len(p.buf); p.pos++ {
+		c := p.buf[p.pos]
+
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+				raw := p.buf[p.valueStart : p.pos+1]
+				if p.isKey {
+					json.Unmarshal(raw, &p.stack[len(p.stack)-1].key)
+				} else {
+					events = p.complete(events, raw)
+				}
+			}
+			continue
+		}
+
+		if p.inLiteral {
+			if !isLiteralEnd(c) {
+				continue
+			}
+			p.inLiteral = false
+			events = p.complete(events, p.buf[p.valueStart:p.pos])
+		}
+
+		switch c {
+		case ' ', '\t', '\n', '\r':
+		case '{', '[':
+			p.stack = append(p.stack, jsonFrame{array: c == '[', start: p.pos, expectKey: c == '{'})
+		case '}', ']':
+			if len(p.stack) == 0 {
+				continue
+			}
+			frame := p.stack[len(p.stack)-1]
+			p.stack = p.stack[:len(p.stack)-1]
+			events = p.complete(events, p.buf[frame.start:p.pos+1])
+		case '"':
+			p.inString = true
+			p.valueStart = p.pos
+			p.isKey = len(p.stack) > 0 && p.stack[len(p.stack)-1].expectKey
+		case ':':
+			if len(p.stack) > 0 {
+				p.stack[len(p.stack)-1].expectKey = false
+			}
+		case ',':
+			if len(p.stack) > 0 {
+				top := &p.stack[len(p.stack)-1]
+				if top.array {
+					top.index++
+				} else {
+					top.expectKey = true
+				}
+			}
+		default:
+			p.inLiteral = true
+			p.valueStart = p.pos
+		}
+	}
+	return events
+}
+
+func isLiteralEnd(c byte) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// complete appends an event for a finished value unless it is the root.
+func (p *JSONStreamParser) complete(events []FieldEvent, raw []byte) []FieldEvent {
+	if len(p.stack) == 0 {
+		return events
+	}
+	value := make(json.RawMessage, len(raw))
+	copy(value, raw)
+	return append(events, FieldEvent{Path: p.path(), Value: value})
+}
+
+// path renders the location of the value being parsed.
+func (p *JSONStreamParser) path() string {
+	var path []byte
+	for _, frame := range p.stack {
+		if frame.array {
+			path = append(path, '[')
+			path = strconv.AppendInt(path, int64(frame.index), 10)
+			path = append(path, ']')
+			continue
+		}
+		if len(path) > 0 {
+			path = append(path, '.')
+		}
+		path = append(path, frame.key...)
+	}
+	return string(path)
+}
@@ -0,0 +1,161 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// ErrConversationNotFound is returned by MemoryStore.Load and Delete for unknown ids.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// MemoryStore persists conversations by ChatContext.Id so that they can be resumed.
+type MemoryStore interface {
+	// Save stores memory under id, replacing an earlier version.
+	Save(ctx context.Context, id int, memory Memory) error
+	Load(ctx context.Context, id int) (Memory, error)
+	// List returns the stored conversations ordered by id.
+	List(ctx context.Context) ([]ConversationInfo, error)
+	Delete(ctx context.Context, id int) error
+}
+
+// ConversationInfo describes a stored conversation.
+type ConversationInfo struct {
+	Id        int       `json:"id"`
+	Messages  int       `json:"messages"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// MessageRecord is the stored form of a message. The openai message params
+// are write-only unions, so they are flattened to their role and text.
+type MessageRecord struct {
+	Role       string `json:"role"`
+	Content    string `json:"content"`
+	Name       string `json:"name,omitempty"`
+	ToolCallID string `json:"toolCallId,omitempty"`
+	// ToolCalls are the tools an assistant message called.
+	ToolCalls []ToolCallRecord `json:"toolCalls,omitempty"`
+	// Pinned marks messages within Memory.Pinned.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// ToolCallRecord is the stored form of a tool call.
+type ToolCallRecord struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Save stores the conversation in store under its Id.
+func (c *ChatContext) Save(ctx context.Context, store MemoryStore) error {
+	return store.Save(ctx, c.Id, c.Snapshot())
+}
+
+// ResumeChatContext loads conversation id from store into a new ChatContext.
+// Options are not stored and are taken from opts.
+func ResumeChatContext(ctx context.Context, store MemoryStore, id int, opts ...Option) (*ChatContext, error) {
+	memory, err := store.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c := NewChatContext(id, opts...)
+	c.Memory = memory
+	return c, nil
+}
+
+// Records converts the messages to their stored form.
+func (m Memory) Records() ([]MessageRecord, error) {
+	records := make([]MessageRecord, len(m.Messages))
+	for i, msg := range m.Messages {
+		record, err := recordFromMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i, err)
+		}
+		record.Pinned = i < m.Pinned
+		records[i] = record
+	}
+	return records, nil
+}
+
+// MemoryFromRecords rebuilds a Memory from stored messages.
+func MemoryFromRecords(records []MessageRecord) (Memory, error) {
+	memory := Memory{Messages: make([]openai.ChatCompletionMessageParamUnion, len(records))}
+	for i, record := range records {
+		msg, err := record.message()
+		if err != nil {
+			return Memory{}, fmt.Errorf("message %d: %w", i, err)
+		}
+		memory.Messages[i] = msg
+		if record.Pinned && memory.Pinned == i {
+			memory.Pinned = i + 1
+		}
+	}
+	return memory, nil
+}
+
+func recordFromMessage(msg openai.ChatCompletionMessageParamUnion) (MessageRecord, error) {
+	switch {
+	case msg.OfSystem != nil:
+		return MessageRecord{Role: "system", Content: msg.OfSystem.Content.OfString.Value, Name: msg.OfSystem.Name.Value}, nil
+	case msg.OfDeveloper != nil:
+		return MessageRecord{Role: "developer", Content: msg.OfDeveloper.Content.OfString.Value, Name: msg.OfDeveloper.Name.Value}, nil
+	case msg.OfUser != nil:
+		if len(msg.OfUser.Content.OfArrayOfContentParts) > 0 {
+			return MessageRecord{}, fmt.Errorf("user messages with content parts cannot be stored")
+		}
+		return MessageRecord{Role: "user", Content: msg.OfUser.Content.OfString.Value, Name: msg.OfUser.Name.Value}, nil
+	case msg.OfAssistant != nil:
+		record := MessageRecord{Role: "assistant", Content: msg.OfAssistant.Content.OfString.Value, Name: msg.OfAssistant.Name.Value}
+		for _, call := range msg.OfAssistant.ToolCalls {
+			record.ToolCalls = append(record.ToolCalls, ToolCallRecord{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+		}
+		return record, nil
+	case msg.OfTool != nil:
+		return MessageRecord{Role: "tool", Content: msg.OfTool.Content.OfString.Value, ToolCallID: msg.OfTool.ToolCallID}, nil
+	default:
+		return MessageRecord{}, fmt.Errorf("unsupported message type")
+	}
+}
+
+func (r MessageRecord) message() (openai.ChatCompletionMessageParamUnion, error) {
+	var msg openai.ChatCompletionMessageParamUnion
+	switch r.Role {
+	case "system":
+		msg = openai.SystemMessage(r.Content)
+		if r.Name != "" {
+			msg.OfSystem.Name = openai.String(r.Name)
+		}
+	case "developer":
+		msg = openai.DeveloperMessage(r.Content)
+		if r.Name != "" {
+			msg.OfDeveloper.Name = openai.String(r.Name)
+		}
+	case "user":
+		msg = openai.UserMessage(r.Content)
+		if r.Name != "" {
+			msg.OfUser.Name = openai.String(r.Name)
+		}
+	case "assistant":
+		msg = openai.AssistantMessage(r.Content)
+		if r.Name != "" {
+			msg.OfAssistant.Name = openai.String(r.Name)
+		}
+		if len(r.ToolCalls) > 0 && r.Content == "" {
+			msg.OfAssistant.Content = openai.ChatCompletionAssistantMessageParamContentUnion{}
+		}
+		for _, call := range r.ToolCalls {
+			msg.OfAssistant.ToolCalls = append(msg.OfAssistant.ToolCalls, openai.ChatCompletionMessageToolCallParam{
+				ID:       call.ID,
+				Function: openai.ChatCompletionMessageToolCallFunctionParam{Name: call.Name, Arguments: call.Arguments},
+			})
+		}
+	case "tool":
+		msg = openai.ToolMessage(r.Content, r.ToolCallID)
+	default:
+		return msg, fmt.Errorf("unknown role %q", r.Role)
+	}
+	return msg, nil
+}
@@ -0,0 +1,158 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+// testStores returns a fresh store of each kind and a function reopening it from disk.
+func testStores(t *testing.T) map[string]func() MemoryStore {
+	t.Helper()
+	dir := t.TempDir()
+	return map[string]func() MemoryStore{
+		"jsonl": func() MemoryStore {
+			return NewJSONLStore(filepath.Join(dir, "conversations.jsonl"))
+		},
+		"sqlite": func() MemoryStore {
+			store, err := NewSQLiteStore(filepath.Join(dir, "conversations.sqlite"))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+}
+
+func testMemory() Memory {
+	named := openai.UserMessage("Which seller sold the most?")
+	named.OfUser.Name = openai.String("analyst")
+	return Memory{Messages: []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage("You write SQL."),
+		named,
+		openai.AssistantMessage(`{"finalOutput":"SELECT 1"}`),
+		openai.ToolMessage(`[{"seller_id":"s1"}]`, "call_1"),
+	}}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	for name, open := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			if err := store.Save(ctx, 2, testMemory()); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if err := store.Save(ctx, 1, Memory{Messages: testMemory().Messages[:1]}); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			// A new store on the same file sees the conversations.
+			store = open()
+			loaded, err := store.Load(ctx, 2)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			want, _ := testMemory().Records()
+			got, err := loaded.Records()
+			if err != nil {
+				t.Fatalf("Records: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected messages: %+v, got: %+v", want, got)
+			}
+
+			if err := store.Save(ctx, 1, testMemory()); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			infos, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(infos) != 2 || infos[0].Id != 1 || infos[0].Messages != 4 || infos[1].Id != 2 || infos[0].UpdatedAt.IsZero() {
+				t.Errorf("Unexpected conversations: %+v", infos)
+			}
+
+			if err := store.Delete(ctx, 1); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Load(ctx, 1); !errors.Is(err, ErrConversationNotFound) {
+				t.Errorf("Expected ErrConversationNotFound after delete, got: %v", err)
+			}
+			if err := store.Delete(ctx, 1); !errors.Is(err, ErrConversationNotFound) {
+				t.Errorf("Expected ErrConversationNotFound deleting twice, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestResumeChatContext(t *testing.T) {
+	ctx := context.Background()
+	store := NewJSONLStore(filepath.Join(t.TempDir(), "conversations.jsonl"))
+
+	fake := NewFakeProvider().OnSchema("Answer", `{"n":1}`, `{"n":2}`)
+	conv := NewChatContext(7, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("first"))
+	if _, err := conv.GenerateResponseFromModelContext(ctx, testSchema); err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+	if err := conv.Save(ctx, store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	resumed, err := ResumeChatContext(ctx, store, 7, WithProvider(fake))
+	if err != nil {
+		t.Fatalf("ResumeChatContext: %v", err)
+	}
+	resumed.AddMessage(openai.UserMessage("second"))
+	if _, err := resumed.GenerateResponseFromModelContext(ctx, testSchema); err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+
+	sent := fake.Calls()[1].Messages
+	if len(sent) != 3 || sent[1].OfAssistant.Content.OfString.Value != `{"n":1}` {
+		t.Errorf("Expected resumed history in the request, got: %d messages", len(sent))
+	}
+	if _, err := ResumeChatContext(ctx, store, 8); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got: %v", err)
+	}
+}
+
+func TestJSONLStoreKeepsFileMode(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "conversations.jsonl")
+	store := NewJSONLStore(path)
+	memory := Memory{Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")}}
+
+	for _, want := range []os.FileMode{0o644, 0o640} {
+		if err := store.Save(ctx, 1, memory); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("Expected mode %v, got: %v", want, got)
+		}
+		// The next save keeps a mode set by the user.
+		if err := os.Chmod(path, 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryRecordsUnsupported(t *testing.T) {
+	memory := Memory{Messages: []openai.ChatCompletionMessageParamUnion{
+		openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{openai.TextContentPart("hi")}),
+	}}
+	if _, err := memory.Records(); err == nil {
+		t.Errorf("Expected an error for content parts")
+	}
+}
@@ -0,0 +1,205 @@
+package structuredoutput
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/openai/openai-go"
+)
+
+// messageOverhead approximates the tokens the chat format adds around each message.
+const messageOverhead = 4
+
+// CountTokens approximates the number of tokens of text without a tokenizer:
+// a word costs one token per four characters and every symbol costs one,
+// which lands within about 10% of the GPT-4 tokenizers on English and SQL.
+func CountTokens(text string) int {
+	tokens := 0
+	word := 0
+	flush := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// MessageTokens approximates the tokens msg takes up in a request.
+func MessageTokens(msg openai.ChatCompletionMessageParamUnion) int {
+	record, err := recordFromMessage(msg)
+	if err != nil {
+		data, _ := json.Marshal(msg)
+		return CountTokens(string(data)) + messageOverhead
+	}
+	tokens := CountTokens(record.Content) + CountTokens(record.Name) + messageOverhead
+	for _, call := range record.ToolCalls {
+		tokens += CountTokens(call.Name) + CountTokens(call.Arguments)
+	}
+	return tokens
+}
+
+// Tokens approximates the tokens all messages take up in a request.
+func (m Memory) Tokens() int {
+	total := 0
+	for _, msg := range m.Messages {
+		total += MessageTokens(msg)
+	}
+	return total
+}
+
+// Pin marks the messages added so far, e.g. the system prompt and few-shot
+// examples, so that memory strategies never drop them.
+func (m *Memory) Pin() {
+	m.Pinned = len(m.Messages)
+}
+
+// MemoryStrategy shrinks a memory that no longer fits the token budget.
+// Strategies keep the pinned messages, the system messages and the last message.
+type MemoryStrategy interface {
+	Fit(ctx context.Context, m Memory, budget int) (Memory, error)
+}
+
+// SlidingWindow drops the oldest unpinned messages until the memory fits.
+type SlidingWindow struct{}
+
+func (SlidingWindow) Fit(ctx context.Context, m Memory, budget int) (Memory, error) {
+	if m.Tokens() <= budget {
+		return m, nil
+	}
+
+	// The last message is kept; when it is a tool result, so are the other
+	// results and the assistant message calling the tools.
+	last := len(m.Messages) - 1
+	for last > m.Pinned && m.Messages[last].OfTool != nil {
+		last--
+	}
+
+	used := 0
+	keep := make([]bool, len(m.Messages))
+	for i, msg := range m.Messages {
+		if i < m.Pinned || msg.OfSystem != nil || i >= last {
+			keep[i] = true
+			used += MessageTokens(msg)
+		}
+	}
+	// Fill the remaining budget with the most recent messages.
+	for i := last - 1; i >= m.Pinned; i-- {
+		if keep[i] {
+			continue
+		}
+		cost := MessageTokens(m.Messages[i])
+		if used+cost > budget {
+			break
+		}
+		keep[i] = true
+		used += cost
+	}
+
+	fitted := Memory{Pinned: m.Pinned, Messages: make([]openai.ChatCompletionMessageParamUnion, 0, len(m.Messages))}
+	dropping := false
+	for i, msg := range m.Messages {
+		if !keep[i] {
+			dropping = true
+			continue
+		}
+		// A tool result without the assistant message that called the tool is rejected by the API.
+		if dropping && msg.OfTool != nil {
+			continue
+		}
+		if msg.OfSystem == nil {
+			dropping = false
+		}
+		fitted.Messages = append(fitted.Messages, msg)
+	}
+	return fitted, nil
+}
+
+// summaryName marks the system message holding a conversation summary.
+const summaryName = "summary"
+
+// DefaultKeepRecent is how many of the latest messages Summarize keeps verbatim.
+const DefaultKeepRecent = 4
+
+// Summarize asks the model to collapse the older turns into a summary
+// message, keeping the latest KeepRecent messages verbatim. If the summary
+// still does not fit, SlidingWindow trims the rest.
+type Summarize struct {
+	// Options configure the summarization conversation, e.g. WithProvider or WithModel.
+	Options []Option
+	// KeepRecent defaults to DefaultKeepRecent.
+	KeepRecent int
+}
+
+type conversationSummary struct {
+	Summary string `json:"summary"`
+}
+
+var summaryFormat = GenerateOptions{
+	Name:        "ConversationSummary",
+	Description: "Summary of the earlier turns of a conversation",
+	MaxRetries:  1,
+}
+
+const summaryPrompt = `Summarize the conversation below for the assistant that continues it.
+Keep the facts, decisions, table and column names, queries and results that later questions may refer to. Be concise.`
+
+func (s Summarize) Fit(ctx context.Context, m Memory, budget int) (Memory, error) {
+	if m.Tokens() <= budget {
+		return m, nil
+	}
+	keepRecent := s.KeepRecent
+	if keepRecent <= 0 {
+		keepRecent = DefaultKeepRecent
+	}
+
+	recent := len(m.Messages) - keepRecent
+	// Keep tool results together with the assistant message calling the tool.
+	for recent > m.Pinned && recent < len(m.Messages) && m.Messages[recent].OfTool != nil {
+		recent--
+	}
+	if recent <= m.Pinned {
+		return SlidingWindow{}.Fit(ctx, m, budget)
+	}
+
+	fitted := Memory{Pinned: m.Pinned, Messages: append([]openai.ChatCompletionMessageParamUnion{}, m.Messages[:m.Pinned]...)}
+	var transcript strings.Builder
+	for _, msg := range m.Messages[m.Pinned:recent] {
+		record, err := recordFromMessage(msg)
+		if err != nil {
+			return m, err
+		}
+		if record.Role == "system" && record.Name != summaryName {
+			fitted.Messages = append(fitted.Messages, msg)
+			continue
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", record.Role, record.Content)
+	}
+
+	conv := NewChatContext(0, s.Options...)
+	conv.AddMessage(openai.SystemMessage(summaryPrompt))
+	conv.AddMessage(openai.UserMessage(transcript.String()))
+	summary, err := Generate[conversationSummary](ctx, conv, summaryFormat)
+	if err != nil {
+		return m, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+
+	msg := openai.SystemMessage("Summary of the earlier conversation: " + summary.Summary)
+	msg.OfSystem.Name = openai.String(summaryName)
+	fitted.Messages = append(fitted.Messages, msg)
+	fitted.Messages = append(fitted.Messages, m.Messages[recent:]...)
+	return SlidingWindow{}.Fit(ctx, fitted, budget)
+}
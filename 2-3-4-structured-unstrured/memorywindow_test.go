@@ -0,0 +1,221 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 4},
+		{"SELECT seller_id FROM sellers;", 10},
+		{"a, b", 3},
+	}
+	for _, tt := range tests {
+		if got := CountTokens(tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q): expected %d, got: %d", tt.text, tt.want, got)
+		}
+	}
+}
+
+// longMemory is a system prompt and one pinned example followed by five turns.
+func longMemory() Memory {
+	m := Memory{}
+	m.Messages = append(m.Messages,
+		openai.SystemMessage("You write SQL."),
+		openai.UserMessage("example question"),
+		openai.AssistantMessage("SELECT 1;"),
+	)
+	m.Pin()
+	for _, text := range []string{"first question", "first answer", "second question", "second answer", "third question"} {
+		m.Messages = append(m.Messages, openai.UserMessage(strings.Repeat(text+" ", 20)))
+	}
+	return m
+}
+
+func contents(m Memory) []string {
+	records, _ := m.Records()
+	var texts []string
+	for _, r := range records {
+		texts = append(texts, strings.Fields(r.Content + " -")[0]+"/"+r.Role)
+	}
+	return texts
+}
+
+func TestSlidingWindow(t *testing.T) {
+	m := longMemory()
+	last := m.Messages[len(m.Messages)-2:]
+	budget := Memory{Messages: append(append([]openai.ChatCompletionMessageParamUnion{}, m.Messages[:3]...), last...)}.Tokens()
+
+	fitted, err := SlidingWindow{}.Fit(context.Background(), m, budget)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	want := "You/system,example/user,SELECT/assistant,second/user,third/user"
+	if got := strings.Join(contents(fitted), ","); got != want {
+		t.Errorf("Expected messages: %s, got: %s", want, got)
+	}
+	if fitted.Tokens() > budget || fitted.Pinned != 3 {
+		t.Errorf("Expected %d pinned messages within %d tokens, got: %d pinned, %d tokens", 3, budget, fitted.Pinned, fitted.Tokens())
+	}
+
+	// Even a budget below the pinned messages keeps them and the last message.
+	fitted, _ = SlidingWindow{}.Fit(context.Background(), m, 1)
+	if got := len(fitted.Messages); got != 4 {
+		t.Errorf("Expected pinned messages and the last one, got: %d messages", got)
+	}
+}
+
+func TestSlidingWindowDropsOrphanToolResults(t *testing.T) {
+	m := Memory{Messages: []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage("You write SQL."),
+		openai.UserMessage(strings.Repeat("question ", 50)),
+		openai.AssistantMessage(strings.Repeat("calling ", 50)),
+		openai.ToolMessage("rows", "call_1"),
+		openai.UserMessage("next"),
+	}}
+	budget := MessageTokens(m.Messages[0]) + MessageTokens(m.Messages[3]) + MessageTokens(m.Messages[4])
+
+	fitted, err := SlidingWindow{}.Fit(context.Background(), m, budget)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if got := strings.Join(contents(fitted), ","); got != "You/system,next/user" {
+		t.Errorf("Expected the tool result to be dropped with its call, got: %s", got)
+	}
+}
+
+func TestSlidingWindowKeepsLastToolCall(t *testing.T) {
+	call := openai.AssistantMessage("")
+	call.OfAssistant.ToolCalls = []openai.ChatCompletionMessageToolCallParam{{
+		ID:       "call_1",
+		Function: openai.ChatCompletionMessageToolCallFunctionParam{Name: "run_query", Arguments: "{}"},
+	}}
+	m := Memory{Messages: []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage("You write SQL."),
+		openai.UserMessage(strings.Repeat("question ", 50)),
+		call,
+		openai.ToolMessage("rows", "call_1"),
+	}}
+
+	fitted, err := SlidingWindow{}.Fit(context.Background(), m, 1)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if got := strings.Join(contents(fitted), ","); got != "You/system,-/assistant,rows/tool" {
+		t.Errorf("Expected the tool result with its call, got: %s", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("ConversationSummary", `{"summary":"The user asked two questions about sellers."}`)
+	m := longMemory()
+
+	fitted, err := Summarize{Options: []Option{WithProvider(fake)}, KeepRecent: 2}.Fit(context.Background(), m, m.Tokens()-1)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	want := "You/system,example/user,SELECT/assistant,Summary/system,second/user,third/user"
+	if got := strings.Join(contents(fitted), ","); got != want {
+		t.Errorf("Expected messages: %s, got: %s", want, got)
+	}
+	if name := fitted.Messages[3].OfSystem.Name.Value; name != summaryName {
+		t.Errorf("Expected summary message name: %s, got: %s", summaryName, name)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 summarization call, got: %d", len(calls))
+	}
+	transcript := calls[0].Messages[1].OfUser.Content.OfString.Value
+	if !strings.Contains(transcript, "user: first question") || strings.Contains(transcript, "third question") || strings.Contains(transcript, "example question") {
+		t.Errorf("Unexpected transcript: %q", transcript)
+	}
+}
+
+func TestChatContextMemoryBudget(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("Answer", `{}`)
+	m := longMemory()
+	conv := NewChatContext(1, WithProvider(fake), WithMemoryBudget(m.Tokens()/2, nil))
+	conv.Memory = m
+
+	if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+	sent := Memory{Messages: fake.Calls()[0].Messages}
+	if sent.Tokens() > m.Tokens()/2 {
+		t.Errorf("Expected at most %d tokens sent, got: %d", m.Tokens()/2, sent.Tokens())
+	}
+	if len(conv.Memory.Messages) != len(sent.Messages)+1 {
+		t.Errorf("Expected the trimmed memory plus the reply, got: %d messages", len(conv.Memory.Messages))
+	}
+}
+
+// signalingProvider reports each request on started and waits for its context to end.
+type signalingProvider struct {
+	started chan struct{}
+}
+
+func (signalingProvider) Name() string  { return "signaling" }
+func (signalingProvider) Model() string { return "signaling" }
+func (p signalingProvider) ChatCompletion(ctx context.Context, _ openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	p.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestChatContextSummarizeUnlocked(t *testing.T) {
+	summarizer := signalingProvider{started: make(chan struct{}, 1)}
+	m := longMemory()
+	conv := NewChatContext(1,
+		WithProvider(NewFakeProvider().OnSchema("Answer", `{}`)),
+		WithTimeout(time.Second),
+		WithMemoryBudget(m.Tokens()/2, Summarize{Options: []Option{WithProvider(summarizer), WithTimeout(0)}, KeepRecent: 2}))
+	conv.Memory = m
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+		done <- err
+	}()
+	<-summarizer.started
+
+	// The conversation stays usable while the summary is being written.
+	conv.AddMessage(openai.UserMessage("added while summarizing"))
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the summary to be in progress, got: %v", err)
+	default:
+	}
+
+	// The summary is bounded by the conversation's timeout.
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got: %v", err)
+	}
+	if got := len(conv.Snapshot().Messages); got != len(m.Messages)+1 {
+		t.Errorf("Expected the memory plus the added message, got: %d messages", got)
+	}
+}
+
+func TestMemoryRecordsPinned(t *testing.T) {
+	records, err := longMemory().Records()
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	m, err := MemoryFromRecords(records)
+	if err != nil {
+		t.Fatalf("MemoryFromRecords: %v", err)
+	}
+	if m.Pinned != 3 {
+		t.Errorf("Expected 3 pinned messages, got: %d", m.Pinned)
+	}
+}
@@ -0,0 +1,145 @@
+package structuredoutput
+
+import "time"
+
+// DefaultTimeout bounds a single model call unless the ChatContext overrides it.
+const DefaultTimeout = 10 * time.Second
+
+// Options control how a ChatContext calls the model.
+type Options struct {
+	// Timeout bounds each model call. Zero leaves the deadline to the caller's context.
+	Timeout time.Duration
+	// Model overrides the Provider's model when set.
+	Model       string
+	Temperature float64
+	// MaxTokens caps the completion length when greater than zero.
+	MaxTokens int64
+	// Seed requests deterministic sampling when set.
+	Seed *int64
+	// MemoryBudget is the token budget for the messages sent to the model.
+	// When the memory exceeds it, MemoryStrategy shrinks it before the call.
+	// Zero sends the whole memory.
+	MemoryBudget int
+	// MemoryStrategy defaults to SlidingWindow.
+	MemoryStrategy MemoryStrategy
+	// Tools are offered to the model; their calls are run until it answers.
+	Tools *ToolRegistry
+	// MaxToolRounds bounds the tool calling rounds of one answer.
+	MaxToolRounds int
+	// Usage, when set, also receives the usage of every model call.
+	Usage *UsageTracker
+	// RateLimiter, when set, paces the model calls and retries rate limit errors.
+	RateLimiter *RateLimiter
+	// Cache, when set, answers requests identical to earlier ones (see CacheKey)
+	// and keeps new answers for CacheTTL, or without expiry when it is zero.
+	Cache    ResponseCache
+	CacheTTL time.Duration
+	// CacheBypass sends every request to the model and refreshes the cache with the answer.
+	CacheBypass bool
+}
+
+func defaultOptions() Options {
+	return Options{
+		Timeout:       DefaultTimeout,
+		Temperature:   0.0,
+		MaxToolRounds: DefaultMaxToolRounds,
+	}
+}
+
+// Option configures a ChatContext.
+type Option func(*ChatContext)
+
+// WithProvider sends the conversation's requests to p instead of the DefaultProvider.
+func WithProvider(p Provider) Option {
+	return func(c *ChatContext) {
+		c.Provider = p
+	}
+}
+
+// WithTimeout bounds each model call. Zero disables the per-call timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *ChatContext) {
+		c.Options.Timeout = d
+	}
+}
+
+// WithModel overrides the model name sent to the Provider.
+func WithModel(name string) Option {
+	return func(c *ChatContext) {
+		c.Options.Model = name
+	}
+}
+
+func WithTemperature(t float64) Option {
+	return func(c *ChatContext) {
+		c.Options.Temperature = t
+	}
+}
+
+func WithMaxTokens(n int64) Option {
+	return func(c *ChatContext) {
+		c.Options.MaxTokens = n
+	}
+}
+
+func WithSeed(seed int64) Option {
+	return func(c *ChatContext) {
+		c.Options.Seed = &seed
+	}
+}
+
+// WithMemoryBudget keeps the messages sent to the model within budget tokens
+// by applying strategy, SlidingWindow when nil, before each call.
+func WithMemoryBudget(budget int, strategy MemoryStrategy) Option {
+	return func(c *ChatContext) {
+		c.Options.MemoryBudget = budget
+		c.Options.MemoryStrategy = strategy
+	}
+}
+
+// WithTools offers the tools in r to the model. Tool calls are run and their
+// results added to the conversation until the model answers.
+func WithTools(r *ToolRegistry) Option {
+	return func(c *ChatContext) {
+		c.Options.Tools = r
+	}
+}
+
+func WithMaxToolRounds(n int) Option {
+	return func(c *ChatContext) {
+		c.Options.MaxToolRounds = n
+	}
+}
+
+// WithUsage adds the usage of the conversation's model calls to t,
+// e.g. to account for all conversations of a pipeline run.
+func WithUsage(t *UsageTracker) Option {
+	return func(c *ChatContext) {
+		c.Options.Usage = t
+	}
+}
+
+// WithRateLimiter keeps the conversation's model calls within the limits of l,
+// shared e.g. by all conversations of a RunBatch.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *ChatContext) {
+		c.Options.RateLimiter = l
+	}
+}
+
+// WithCache answers requests the cache has seen from it and keeps new answers
+// for ttl, or without expiry when ttl is zero.
+func WithCache(cache ResponseCache, ttl time.Duration) Option {
+	return func(c *ChatContext) {
+		c.Options.Cache = cache
+		c.Options.CacheTTL = ttl
+	}
+}
+
+// WithCacheBypass asks the model even when the cache has an answer and stores
+// the new one, e.g. to refresh a cache after a prompt change.
+func WithCacheBypass() Option {
+	return func(c *ChatContext) {
+		c.Options.CacheBypass = true
+	}
+}
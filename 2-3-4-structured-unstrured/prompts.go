@@ -0,0 +1,177 @@
+package structuredoutput
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+)
+
+// Prompt is one version of a named prompt template.
+type Prompt struct {
+	Name    string
+	Version string
+	tmpl    *template.Template
+}
+
+// String identifies the prompt as name@version, e.g. to record it with results.
+func (p *Prompt) String() string {
+	return p.Name + "@" + p.Version
+}
+
+// Render executes the template with data.
+func (p *Prompt) Render(data any) (string, error) {
+	var b strings.Builder
+	if err := p.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p, err)
+	}
+	return b.String(), nil
+}
+
+// promptFuncs are available in every prompt template. lower and upper take
+// any value, e.g. a named string type.
+var promptFuncs = template.FuncMap{
+	"lower": func(v any) string { return strings.ToLower(fmt.Sprint(v)) },
+	"upper": func(v any) string { return strings.ToUpper(fmt.Sprint(v)) },
+	"join":  strings.Join,
+}
+
+// PromptRegistry holds versioned text/template prompts by name. Get returns the
+// version chosen with Use, or else the latest one. It is safe for concurrent use.
+type PromptRegistry struct {
+	mu       sync.RWMutex
+	prompts  map[string]map[string]*Prompt
+	selected map[string]string
+}
+
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{prompts: map[string]map[string]*Prompt{}, selected: map[string]string{}}
+}
+
+// Add parses text as version of the prompt name, replacing an earlier one.
+func (r *PromptRegistry) Add(name, version, text string) error {
+	tmpl, err := template.New(name + "@" + version).Funcs(promptFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse prompt %s@%s: %w", name, version, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.prompts[name] == nil {
+		r.prompts[name] = map[string]*Prompt{}
+	}
+	r.prompts[name][version] = &Prompt{Name: name, Version: version, tmpl: tmpl}
+	return nil
+}
+
+// Load adds the templates in fsys laid out as <name>/<version>.tmpl, e.g. from
+// an embed.FS or os.DirFS. A single trailing newline of a file is dropped.
+func (r *PromptRegistry) Load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*/*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt: %w", err)
+		}
+		name, version := path.Dir(file), strings.TrimSuffix(path.Base(file), ".tmpl")
+		if err := r.Add(name, version, strings.TrimSuffix(string(data), "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Use makes Get return version of the prompt name.
+func (r *PromptRegistry) Use(name, version string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.prompts[name][version]; !ok {
+		return fmt.Errorf("unknown prompt %s@%s", name, version)
+	}
+	r.selected[name] = version
+	return nil
+}
+
+// Get returns the selected version of the prompt name.
+func (r *PromptRegistry) Get(name string) (*Prompt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := r.prompts[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("unknown prompt %s", name)
+	}
+	if version, ok := r.selected[name]; ok {
+		return versions[version], nil
+	}
+	latest := slices.MaxFunc(slices.Collect(maps.Keys(versions)), compareVersions)
+	return versions[latest], nil
+}
+
+// Version returns a specific version of the prompt name.
+func (r *PromptRegistry) Version(name, version string) (*Prompt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.prompts[name][version]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt %s@%s", name, version)
+	}
+	return p, nil
+}
+
+// Versions lists the versions of the prompt name from oldest to latest.
+func (r *PromptRegistry) Versions(name string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := slices.Collect(maps.Keys(r.prompts[name]))
+	slices.SortFunc(versions, compareVersions)
+	return versions
+}
+
+// Render renders the selected version of the prompt name with data and
+// returns the prompt it used.
+func (r *PromptRegistry) Render(name string, data any) (string, *Prompt, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return "", nil, err
+	}
+	text, err := p.Render(data)
+	return text, p, err
+}
+
+// compareVersions orders versions with their numbers compared by value,
+// so that v2 comes before v10.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		pa, ra := versionPart(a)
+		pb, rb := versionPart(b)
+		na, errA := strconv.Atoi(pa)
+		nb, errB := strconv.Atoi(pb)
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			return cmp.Compare(na, nb)
+		case (errA != nil || errB != nil) && pa != pb:
+			return strings.Compare(pa, pb)
+		}
+		a, b = ra, rb
+	}
+	return strings.Compare(a, b)
+}
+
+// versionPart splits the leading run of digits or of other characters off v.
+func versionPart(v string) (string, string) {
+	digit := unicode.IsDigit(rune(v[0]))
+	i := 1
+	for i < len(v) && unicode.IsDigit(rune(v[i])) == digit {
+		i++
+	}
+	return v[:i], v[i:]
+}
@@ -0,0 +1,50 @@
+package structuredoutput
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPromptRegistry(t *testing.T) {
+	prompts := NewPromptRegistry()
+	err := prompts.Load(fstest.MapFS{
+		"greet/v1.tmpl":  {Data: []byte("Hello {{.Name}}.\n")},
+		"greet/v2.tmpl":  {Data: []byte("Hi {{upper .Name}}.")},
+		"greet/v10.tmpl": {Data: []byte("Hey {{.Name}}, {{join .Tags \", \"}}.")},
+		"README.md":      {Data: []byte("not a prompt")},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := prompts.Versions("greet"); !reflect.DeepEqual(got, []string{"v1", "v2", "v10"}) {
+		t.Errorf("expected versions in order, got %v", got)
+	}
+
+	text, p, err := prompts.Render("greet", map[string]any{"Name": "Ana", "Tags": []string{"a", "b"}})
+	if err != nil || text != "Hey Ana, a, b." || p.String() != "greet@v10" {
+		t.Errorf("expected the latest version, got %q from %v (%v)", text, p, err)
+	}
+
+	if err := prompts.Use("greet", "v1"); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+	text, p, err = prompts.Render("greet", map[string]any{"Name": "Ana"})
+	if err != nil || text != "Hello Ana." || p.Version != "v1" {
+		t.Errorf("expected the selected version without the trailing newline, got %q from %v (%v)", text, p, err)
+	}
+
+	if _, _, err := prompts.Render("greet", map[string]any{}); err == nil || !strings.Contains(err.Error(), "greet@v1") {
+		t.Errorf("expected an error for a missing variable, got: %v", err)
+	}
+	if err := prompts.Use("greet", "v3"); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+	if _, err := prompts.Get("farewell"); err == nil {
+		t.Error("expected an error for an unknown prompt")
+	}
+	if err := prompts.Add("broken", "v1", "{{.Name"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
@@ -0,0 +1,209 @@
+package structuredoutput
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Provider is a chat completion backend that understands JSON-schema response formats.
+// A ChatContext sends every request through its Provider, so switching between
+// OpenAI, Azure OpenAI and a local Ollama model does not require code changes.
+type Provider interface {
+	// Name identifies the backend, e.g. "openai", "azure" or "ollama".
+	Name() string
+	// Model is the model (or Azure deployment) used for requests.
+	Model() string
+	// ChatCompletion sends the request to the backend and returns the completion.
+	ChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error)
+}
+
+const (
+	ProviderOpenAI = "openai"
+	ProviderAzure  = "azure"
+	ProviderOllama = "ollama"
+)
+
+const (
+	defaultOllamaHost  = "http://localhost:11434"
+	defaultOllamaModel = "llama3.2"
+)
+
+var defaultProvider Provider
+var defaultProviderMu sync.Mutex
+
+// openAICompatible talks to any backend that exposes the OpenAI chat completions API.
+type openAICompatible struct {
+	name   string
+	model  string
+	client openai.Client
+}
+
+func (p *openAICompatible) Name() string  { return p.name }
+func (p *openAICompatible) Model() string { return p.model }
+
+func (p *openAICompatible) ChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if params.Model == "" {
+		params.Model = p.model
+	}
+	return p.client.Chat.Completions.New(ctx, params)
+}
+
+func (p *openAICompatible) ChatCompletionStream(ctx context.Context, params openai.ChatCompletionNewParams, onDelta func(string)) (*openai.ChatCompletion, error) {
+	if params.Model == "" {
+		params.Model = p.model
+	}
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+
+	stream := p.client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+	acc := openai.ChatCompletionAccumulator{}
+	for stream.Next() {
+		chunk := stream.Current()
+		if !acc.AddChunk(chunk) {
+			return nil, fmt.Errorf("failed to accumulate stream chunk %s", chunk.ID)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	return &acc.ChatCompletion, nil
+}
+
+// NewOpenAIProvider returns a Provider for the OpenAI API.
+// An empty model defaults to GPT-4o. The API key is read from OPENAI_API_KEY
+// unless overridden by opts.
+func NewOpenAIProvider(model string, opts ...option.RequestOption) Provider {
+	if model == "" {
+		model = openai.ChatModelGPT4o
+	}
+	return &openAICompatible{
+		name:   ProviderOpenAI,
+		model:  model,
+		client: openai.NewClient(opts...),
+	}
+}
+
+// AzureConfig holds the settings needed to reach an Azure OpenAI deployment.
+type AzureConfig struct {
+	Endpoint   string
+	APIVersion string
+	Deployment string
+	APIKey     string
+}
+
+// AzureConfigFromEnv reads the AZURE_OPENAI_* environment variables.
+// AZURE_OPENAI_API_KEY falls back to OPENAI_API_KEY when unset.
+func AzureConfigFromEnv() AzureConfig {
+	apiKey := os.Getenv("AZURE_OPENAI_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	return AzureConfig{
+		Endpoint:   os.Getenv("AZURE_OPENAI_ENDPOINT"),
+		APIVersion: os.Getenv("AZURE_OPENAI_API_VERSION"),
+		Deployment: os.Getenv("AZURE_OPENAI_DEPLOYMENT"),
+		APIKey:     apiKey,
+	}
+}
+
+// NewAzureProvider returns a Provider for an Azure OpenAI deployment.
+// Requests are routed to {Endpoint}/openai/deployments/{Deployment} with the
+// configured api-version and authenticated with the api-key header.
+func NewAzureProvider(cfg AzureConfig, opts ...option.RequestOption) (Provider, error) {
+	if cfg.Endpoint == "" || cfg.APIVersion == "" || cfg.Deployment == "" {
+		return nil, fmt.Errorf("azure provider requires endpoint, api version and deployment")
+	}
+
+	baseURL := strings.TrimRight(cfg.Endpoint, "/") + "/openai/deployments/" + cfg.Deployment + "/"
+	azureOpts := []option.RequestOption{
+		option.WithBaseURL(baseURL),
+		option.WithQuery("api-version", cfg.APIVersion),
+		option.WithHeader("api-key", cfg.APIKey),
+		option.WithHeaderDel("authorization"),
+	}
+
+	return &openAICompatible{
+		name:   ProviderAzure,
+		model:  cfg.Deployment,
+		client: openai.NewClient(append(azureOpts, opts...)...),
+	}, nil
+}
+
+// NewOllamaProvider returns a Provider for a local Ollama server using its
+// OpenAI compatible endpoint. Empty host and model default to
+// http://localhost:11434 and llama3.2.
+func NewOllamaProvider(host string, model string, opts ...option.RequestOption) Provider {
+	if host == "" {
+		host = defaultOllamaHost
+	}
+	if model == "" {
+		model = defaultOllamaModel
+	}
+
+	ollamaOpts := []option.RequestOption{
+		option.WithBaseURL(strings.TrimRight(host, "/") + "/v1/"),
+		// Ollama ignores the key but the client always sends one.
+		option.WithAPIKey(ProviderOllama),
+	}
+
+	return &openAICompatible{
+		name:   ProviderOllama,
+		model:  model,
+		client: openai.NewClient(append(ollamaOpts, opts...)...),
+	}
+}
+
+// NewProviderFromEnv builds the Provider named by LLMDOJO_PROVIDER
+// ("openai", "azure" or "ollama"), defaulting to OpenAI when unset.
+// Ollama reads OLLAMA_HOST and OLLAMA_MODEL, OpenAI reads OPENAI_MODEL.
+func NewProviderFromEnv() (Provider, error) {
+	return NewProvider(os.Getenv("LLMDOJO_PROVIDER"))
+}
+
+// NewProvider builds a Provider by name using the environment for its settings.
+func NewProvider(name string) (Provider, error) {
+	switch strings.ToLower(name) {
+	case "", ProviderOpenAI:
+		return NewOpenAIProvider(os.Getenv("OPENAI_MODEL")), nil
+	case ProviderAzure:
+		return NewAzureProvider(AzureConfigFromEnv())
+	case ProviderOllama:
+		return NewOllamaProvider(os.Getenv("OLLAMA_HOST"), os.Getenv("OLLAMA_MODEL")), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+}
+
+// SetDefaultProvider sets the Provider used by chat contexts that do not have one.
+func SetDefaultProvider(p Provider) {
+	defaultProviderMu.Lock()
+	defer defaultProviderMu.Unlock()
+	defaultProvider = p
+}
+
+// DefaultProvider returns the Provider used by chat contexts that do not have one.
+// Unless set with SetDefaultProvider it is built from the environment on first use.
+func DefaultProvider() Provider {
+	defaultProviderMu.Lock()
+	defer defaultProviderMu.Unlock()
+
+	if defaultProvider == nil {
+		p, err := NewProviderFromEnv()
+		if err != nil {
+			log.Printf("Error creating provider from environment, using OpenAI: %v", err)
+			p = NewOpenAIProvider("")
+		}
+		defaultProvider = p
+	}
+	return defaultProvider
+}
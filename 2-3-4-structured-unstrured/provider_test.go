@@ -0,0 +1,137 @@
+package structuredoutput
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+const testCompletion = `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"test","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"{}"}}]}`
+
+func TestAzureProviderRouting(t *testing.T) {
+	var gotPath, gotVersion, gotKey, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotVersion = r.URL.Query().Get("api-version")
+		gotKey = r.Header.Get("api-key")
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testCompletion))
+	}))
+	defer srv.Close()
+
+	p, err := NewAzureProvider(AzureConfig{
+		Endpoint:   srv.URL,
+		APIVersion: "2024-06-01",
+		Deployment: "gpt-4o-dev",
+		APIKey:     "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewAzureProvider: %v", err)
+	}
+
+	_, err = p.ChatCompletion(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+
+	if gotPath != "/openai/deployments/gpt-4o-dev/chat/completions" {
+		t.Errorf("unexpected path %q", gotPath)
+	}
+	if gotVersion != "2024-06-01" {
+		t.Errorf("unexpected api-version %q", gotVersion)
+	}
+	if gotKey != "secret" {
+		t.Errorf("unexpected api-key %q", gotKey)
+	}
+	if gotAuth != "" {
+		t.Errorf("authorization header should not be sent, got %q", gotAuth)
+	}
+}
+
+func TestAzureProviderRequiresConfig(t *testing.T) {
+	if _, err := NewAzureProvider(AzureConfig{Endpoint: "https://example.openai.azure.com"}); err == nil {
+		t.Fatal("expected error for missing api version and deployment")
+	}
+}
+
+func TestOllamaProviderRouting(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testCompletion))
+	}))
+	defer srv.Close()
+
+	p := NewOllamaProvider(srv.URL, "")
+	if p.Model() != "llama3.2" {
+		t.Errorf("unexpected default model %q", p.Model())
+	}
+
+	_, err := p.ChatCompletion(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	})
+	if err != nil {
+		t.Fatalf("ChatCompletion: %v", err)
+	}
+	if gotPath != "/v1/chat/completions" {
+		t.Errorf("unexpected path %q", gotPath)
+	}
+}
+
+func TestNewProviderUnknown(t *testing.T) {
+	if _, err := NewProvider("bedrock"); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestOpenAIProviderStream(t *testing.T) {
+	chunks := []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"test","choices":[{"index":0,"delta":{"role":"assistant","content":"{\"value\":"}}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"test","choices":[{"index":0,"delta":{"content":"42}"},"finish_reason":"stop"}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"test","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":3,"total_tokens":8}}`,
+	}
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider("", option.WithBaseURL(srv.URL), option.WithAPIKey("test")).(StreamingProvider)
+	var deltas []string
+	resp, err := p.ChatCompletionStream(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hi")},
+	}, func(delta string) { deltas = append(deltas, delta) })
+	if err != nil {
+		t.Fatalf("ChatCompletionStream: %v", err)
+	}
+
+	if !strings.Contains(string(gotBody), `"stream":true`) || !strings.Contains(string(gotBody), `"include_usage":true`) {
+		t.Errorf("expected a streaming request with usage, got %s", gotBody)
+	}
+	if strings.Join(deltas, "|") != `{"value":|42}` {
+		t.Errorf("unexpected deltas %q", deltas)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Content != `{"value":42}` || choice.FinishReason != "stop" {
+		t.Errorf("unexpected accumulated choice %+v", choice)
+	}
+	if resp.Usage.TotalTokens != 8 {
+		t.Errorf("expected usage from the last chunk, got %d", resp.Usage.TotalTokens)
+	}
+}
@@ -0,0 +1,187 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// DefaultRateLimitRetries is how often a call is retried after a rate limit
+// error unless the RateLimiter overrides it.
+const DefaultRateLimitRetries = 5
+
+// RateLimiter keeps the model calls of many conversations within a provider's
+// requests-per-minute and tokens-per-minute limits, and retries calls the
+// provider rejected with 429 Too Many Requests. It is safe for concurrent use;
+// share one between the conversations of a batch with WithRateLimiter.
+type RateLimiter struct {
+	// MaxRetries bounds the retries of one call after rate limit errors.
+	MaxRetries int
+	// Backoff is the first wait after a rate limit error without Retry-After.
+	// It doubles with every retry.
+	Backoff time.Duration
+
+	mu     sync.Mutex
+	rpm    int
+	tpm    int
+	window time.Duration
+	sent   []*rateLimitedCall
+}
+
+// rateLimitedCall is a call counted against the limits for one window.
+type rateLimitedCall struct {
+	at     time.Time
+	tokens int
+}
+
+// NewRateLimiter allows rpm requests and tpm tokens per minute.
+// A limit of zero is not enforced.
+func NewRateLimiter(rpm, tpm int) *RateLimiter {
+	return &RateLimiter{
+		MaxRetries: DefaultRateLimitRetries,
+		Backoff:    time.Second,
+		rpm:        rpm,
+		tpm:        tpm,
+		window:     time.Minute,
+	}
+}
+
+// Wait blocks until a call of the estimated tokens fits the limits and counts
+// it. The returned func corrects the count to the tokens the call actually used.
+// A single call larger than the token limit is let through once the window is empty.
+func (l *RateLimiter) Wait(ctx context.Context, tokens int) (func(used int), error) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.expire(now)
+		wait := l.delay(now, tokens)
+		if wait == 0 {
+			call := &rateLimitedCall{at: now, tokens: tokens}
+			l.sent = append(l.sent, call)
+			l.mu.Unlock()
+			return func(used int) {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				call.tokens = used
+			}, nil
+		}
+		l.mu.Unlock()
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// expire drops the calls that left the window. It is called with l.mu held.
+func (l *RateLimiter) expire(now time.Time) {
+	i := 0
+	for i < len(l.sent) && now.Sub(l.sent[i].at) >= l.window {
+		i++
+	}
+	l.sent = l.sent[i:]
+}
+
+// delay returns how long a call of tokens has to wait, zero when it may go now.
+// It is called with l.mu held.
+func (l *RateLimiter) delay(now time.Time, tokens int) time.Duration {
+	if len(l.sent) == 0 {
+		return 0
+	}
+	if l.rpm > 0 && len(l.sent) >= l.rpm {
+		return l.sent[len(l.sent)-l.rpm].at.Add(l.window).Sub(now)
+	}
+	if l.tpm <= 0 {
+		return 0
+	}
+	used := 0
+	for _, call := range l.sent {
+		used += call.tokens
+	}
+	if used+tokens <= l.tpm {
+		return 0
+	}
+	// Wait for the oldest calls to free enough tokens.
+	for _, call := range l.sent {
+		used -= call.tokens
+		if used+tokens <= l.tpm || used == 0 {
+			return call.at.Add(l.window).Sub(now)
+		}
+	}
+	return 0
+}
+
+// do makes a model call of the estimated tokens with send, waiting for the
+// limits first and retrying it after rate limit errors.
+func (l *RateLimiter) do(ctx context.Context, tokens int, send func(context.Context) (*openai.ChatCompletion, error)) (*openai.ChatCompletion, error) {
+	for attempt := 0; ; attempt++ {
+		done, err := l.Wait(ctx, tokens)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := send(ctx)
+		switch {
+		case err != nil:
+			// A rejected call still counts as a request but used no tokens.
+			done(0)
+		case resp.Usage.TotalTokens > 0:
+			done(int(resp.Usage.TotalTokens))
+		}
+
+		wait, retry := l.retryDelay(err, attempt)
+		if !retry {
+			return resp, err
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retry attempt n (from 0) after err,
+// and false when err is not a rate limit error or no retries are left.
+func (l *RateLimiter) retryDelay(err error, attempt int) (time.Duration, bool) {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || attempt >= l.MaxRetries {
+		return 0, false
+	}
+	if apiErr.Response != nil {
+		if d, ok := retryAfter(apiErr.Response.Header); ok {
+			return d, true
+		}
+	}
+	return l.Backoff << attempt, true
+}
+
+// retryAfter reads the Retry-After header as seconds or as a date,
+// and OpenAI's retry-after-ms header.
+func retryAfter(h http.Header) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	value := h.Get("Retry-After")
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
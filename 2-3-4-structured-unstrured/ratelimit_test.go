@@ -0,0 +1,121 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func newTestRateLimiter(rpm, tpm int, window time.Duration) *RateLimiter {
+	l := NewRateLimiter(rpm, tpm)
+	l.window = window
+	return l
+}
+
+func TestRateLimiterRequests(t *testing.T) {
+	const window = 50 * time.Millisecond
+	l := newTestRateLimiter(2, 0, window)
+
+	start := time.Now()
+	for range 3 {
+		if _, err := l.Wait(context.Background(), 10); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < window {
+		t.Errorf("expected the third request to wait for the window, waited %s", elapsed)
+	}
+}
+
+func TestRateLimiterTokens(t *testing.T) {
+	const window = 50 * time.Millisecond
+	l := newTestRateLimiter(0, 100, window)
+
+	start := time.Now()
+	done, err := l.Wait(context.Background(), 80)
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	// The call used fewer tokens than estimated, so the next one fits.
+	done(20)
+	if _, err := l.Wait(context.Background(), 80); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= window {
+		t.Errorf("expected no wait after correcting the tokens, waited %s", elapsed)
+	}
+
+	if _, err := l.Wait(context.Background(), 50); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < window {
+		t.Errorf("expected a wait for the token limit, waited %s", elapsed)
+	}
+
+	// A call over the limit goes alone once the window is empty.
+	if _, err := newTestRateLimiter(0, 100, window).Wait(context.Background(), 500); err != nil {
+		t.Errorf("expected an oversized call to pass, got: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Wait(ctx, 100); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled wait, got: %v", err)
+	}
+}
+
+func rateLimitError(header http.Header) error {
+	return &openai.Error{StatusCode: http.StatusTooManyRequests, Response: &http.Response{StatusCode: http.StatusTooManyRequests, Header: header}}
+}
+
+func TestRateLimiterRetry(t *testing.T) {
+	fake := NewFakeProvider().On("Answer", "",
+		FakeResponse{Err: rateLimitError(http.Header{"Retry-After-Ms": {"20"}})},
+		FakeResponse{Err: rateLimitError(nil)},
+		FakeResponse{Content: `{}`},
+	)
+	limiter := NewRateLimiter(0, 0)
+	limiter.Backoff = 10 * time.Millisecond
+	conv := newPrimedContext(WithProvider(fake), WithRateLimiter(limiter))
+
+	start := time.Now()
+	completion, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema)
+	if err != nil {
+		t.Fatalf("GenerateResponseFromModelContext: %v", err)
+	}
+	if len(fake.Calls()) != 3 || completion.Usage.Calls != 1 {
+		t.Errorf("expected 3 requests and 1 answered call, got %d and %+v", len(fake.Calls()), completion.Usage)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected to wait for Retry-After and the backoff, waited %s", elapsed)
+	}
+
+	limiter.MaxRetries = 0
+	fake = NewFakeProvider().On("Answer", "", FakeResponse{Err: rateLimitError(nil)}, FakeResponse{Content: `{}`})
+	conv = newPrimedContext(WithProvider(fake), WithRateLimiter(limiter))
+	if _, err := conv.GenerateResponseFromModelContext(context.Background(), testSchema); err == nil {
+		t.Error("expected the rate limit error without retries")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{http.Header{"Retry-After": {"2"}}, 2 * time.Second, true},
+		{http.Header{"Retry-After-Ms": {"150"}, "Retry-After": {"1"}}, 150 * time.Millisecond, true},
+		{http.Header{"Retry-After": {time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}}, 0, true},
+		{http.Header{}, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := retryAfter(tt.header); got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%v): expected %s %v, got %s %v", tt.header, tt.want, tt.ok, got, ok)
+		}
+	}
+}
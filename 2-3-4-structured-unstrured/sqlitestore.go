@@ -0,0 +1,110 @@
+package structuredoutput
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore is a MemoryStore keeping conversations in a SQLite database,
+// one row per conversation with its messages as JSON.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the database at path and its conversations table.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open conversation store: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS conversations (
+		id INTEGER PRIMARY KEY,
+		messages TEXT NOT NULL,
+		message_count INTEGER NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create conversations table: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) Save(ctx context.Context, id int, memory Memory) error {
+	records, err := memory.Records()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation %d: %w", id, err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO conversations (id, messages, message_count, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET messages = excluded.messages, message_count = excluded.message_count, updated_at = excluded.updated_at`,
+		id, string(data), len(records), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save conversation %d: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Load(ctx context.Context, id int) (Memory, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT messages FROM conversations WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Memory{}, fmt.Errorf("%w: %d", ErrConversationNotFound, id)
+	}
+	if err != nil {
+		return Memory{}, fmt.Errorf("failed to load conversation %d: %w", id, err)
+	}
+
+	var records []MessageRecord
+	if err := json.Unmarshal([]byte(data), &records); err != nil {
+		return Memory{}, fmt.Errorf("failed to decode conversation %d: %w", id, err)
+	}
+	return MemoryFromRecords(records)
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]ConversationInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, message_count, updated_at FROM conversations ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var infos []ConversationInfo
+	for rows.Next() {
+		var info ConversationInfo
+		if err := rows.Scan(&info.Id, &info.Messages, &info.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		infos = append(infos, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating conversations: %w", err)
+	}
+	return infos, nil
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM conversations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %d", ErrConversationNotFound, id)
+	}
+	return nil
+}
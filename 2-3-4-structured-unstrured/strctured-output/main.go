@@ -1,295 +1,375 @@
+// Command strctured-output answers questions about a SQLite database with text2sql.
+//
+// Usage:
+//
+//	go run ./strctured-output -db olist.sqlite [-questions questions.txt] [-q question] [-format table|json|csv]
+//	go run ./strctured-output -db olist.sqlite -eval olist_eval.jsonl [-format json]
+//	go run ./strctured-output -db olist.sqlite -examples olist_examples.jsonl [-k 3]
+//	go run ./strctured-output -db olist.sqlite -session session.jsonl [-session-id 1] -q question
+//	go run ./strctured-output -db olist.sqlite -stream -q question
 package main
 
 import (
+	"bufio"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	structuredoutput "llmdojo"
+	"llmdojo/text2sql"
 	"log"
-
-	"database/sql"
-
-	"github.com/invopop/jsonschema"
-	_ "github.com/mattn/go-sqlite3"
-	"github.com/openai/openai-go"
+	"os"
+	"strings"
+	"time"
 )
 
-type Step struct {
-	Explanation string `json:"explanation"`
-	// Output      string `json:"output"`
-}
-type AgentResponseFormat struct {
-	Steps       []Step `json:"steps"`
-	FinalOutput string `json:"finalOutput"`
-}
-
-var respSchema = openai.ResponseFormatJSONSchemaJSONSchemaParam{
-	Name:        "SqlPipeline",
-	Description: openai.String("SQL pipeline for generating SQL queries"),
-	Schema:      GenerateSchema[AgentResponseFormat](),
-	Strict:      openai.Bool(true),
+// defaultQuestions are asked when neither -q nor -questions is given.
+var defaultQuestions = []string{
+	"Which seller has delivered the most orders to customers in Rio de Janeiro? [string: seller_id]",
+	// "What's the average review score for products in the 'beleza_saude' category? [float: score]",
+	// "How many sellers have completed orders worth more than 100,000 BRL in total? [integer: count]",
+	// "Which product category has the highest rate of 5 - star reviews ? [string: category_name]",
+	// "What's the most common payment installment count for orders over 1000 BRL? [integer: installments]",
+	// "Which city has the highest average freight value per order? [string: city_name]",
+	// "What's the most expensive product category based on average price? [string: category_name]",
+	// "Which product category has the shortest average delivery time? [string: category_name]",
+	// "How many unique customers have placed orders in the state of Sao Paulo? [integer: count]",
+	// "What percentage of orders are delivered before the estimated delivery date ? [float: percentage]"
 }
 
-func GenerateSchema[T any]() interface{} {
-
-	reflector := jsonschema.Reflector{
-		AllowAdditionalProperties: false,
-		DoNotReference:            true,
+func main() {
+	dbPath := flag.String("db", "olist.sqlite", "path to the SQLite database")
+	provider := flag.String("provider", "", "model provider: openai, azure or ollama (default from LLMDOJO_PROVIDER)")
+	model := flag.String("model", "", "model name (default depends on the provider)")
+	questionFile := flag.String("questions", "", "file with one question per line; blank lines and lines starting with # are skipped")
+	question := flag.String("q", "", "a single question to ask")
+	format := flag.String("format", "table", "output format: table, json or csv")
+	schemaFormat := flag.String("schema-format", "ddl", "how the schema is shown to the model: ddl, mermaid, or tools to let the model explore the database")
+	timeout := flag.Duration("timeout", text2sql.DefaultTimeout, "timeout for each model call")
+	repairs := flag.Int("repairs", text2sql.DefaultRepairRounds, "how often a failing query is sent back to the model")
+	examplesFile := flag.String("examples", "", "JSONL file of question/answer examples; the most similar ones are shown per question")
+	examplesTable := flag.String("examples-table", "", "table in -db holding question/answer examples, instead of -examples")
+	maxExamples := flag.Int("k", text2sql.DefaultMaxExamples, "how many examples are shown per question with -examples or -examples-table")
+	verify := flag.String("verify-examples", "explain", "check the examples against -db at startup and drop broken ones: explain, execute or off")
+	examplesEval := flag.String("examples-eval", "", "execute the examples and write the verified ones to this JSONL file as eval cases")
+	session := flag.String("session", "", "JSONL file keeping the conversation, so follow-up questions see the earlier ones")
+	sessionID := flag.Int("session-id", 1, "conversation id within -session")
+	memoryBudget := flag.Int("memory-budget", 0, "token budget for the conversation sent to the model; older turns are dropped beyond it (0 keeps everything)")
+	summarize := flag.Bool("summarize", false, "summarize older turns instead of dropping them when over -memory-budget")
+	stream := flag.Bool("stream", false, "show the model's steps on stderr while it writes them")
+	pricesFile := flag.String("prices", "", "JSON price table in USD per million tokens for the cost estimate (default: built-in OpenAI prices)")
+	workers := flag.Int("workers", 1, "how many questions or eval cases are asked at once; -session asks one at a time")
+	rpm := flag.Int("rpm", 0, "requests per minute allowed to the model provider (0: no limit)")
+	tpm := flag.Int("tpm", 0, "tokens per minute allowed to the model provider (0: no limit)")
+	cacheFile := flag.String("cache", "", "SQLite file caching the model's answers, so repeated runs do not pay for identical calls")
+	cacheTTL := flag.Duration("cache-ttl", 0, "how long cached answers are kept (0: forever)")
+	cacheBypass := flag.Bool("cache-bypass", false, "ask the model even for cached requests and refresh the cache")
+	promptsDir := flag.String("prompts", "", "directory of prompt templates laid out as <name>/<version>.tmpl, added to the built-in ones")
+	promptVersion := flag.String("prompt-version", "", "version of the sql-system prompt to use (default: the latest)")
+	fallbackChain := flag.String("fallback", "", "comma-separated provider:model pairs tried in order when the model times out, fails or refuses, e.g. openai:gpt-4o-mini,ollama:llama3.2")
+	evalFile := flag.String("eval", "", "run the eval dataset in this JSONL file and print a markdown (or -format json) report")
+	flag.Parse()
+
+	var out answerWriter
+	var err error
+	if *evalFile == "" {
+		if out, err = newWriter(*format, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
 	}
-	var v T
-	schema := reflector.Reflect(v)
-	return schema
-}
-
-const initialContext = `You are an expert in Databases SQLite, Python and data analysis.
-			You need to are given this database schema and a a following question.
-            You need to provide  correct SQL query to answer the question.
-            You need to provide the SQL query only, & that has to be correct and without newline. 
-            Do explain your reasoning in 1-3 steps and then finally provide the SQL query. 
-            Database schema is attached below. Note the relationships between tables and the data types of each column.
-            The database schema is as follows:
-            
-erDiagram
-    orders || --o{
-            order_items: contains
-    orders || --o{
-            order_payments: has
-    orders || --o{
-            order_reviews: has
-    orders
-        } | --|| customers : placed_by
-    order_items } | --|| products : includes
-    order_items }| --|| sellers : sold_by
-sellers }| --|| geolocation : located_in
-customers }| --|| geolocation : located_in
-
-    orders {
-        string order_id
-        string customer_id
-        string order_status
-        datetime order_purchase_timestamp
-        datetime order_approved_at
-        datetime order_delivered_carrier_date
-        datetime order_delivered_customer_date
-        datetime order_estimated_delivery_date
-}
 
-    order_items {
-        string order_id
-        int order_item_id
-        string product_id
-        string seller_id
-        datetime shipping_limit_date
-        float price
-        float freight_value
-}
-
-    order_payments {
-        string order_id
-        int payment_sequential
-        string payment_type
-        int payment_installments
-        float payment_value
-}
-
-    order_reviews {
-        string review_id
-        string order_id
-        int review_score
-        string review_comment_title
-        string review_comment_message
-        datetime review_creation_date
-        datetime review_answer_timestamp
-}
-
-    customers {
-        string customer_id
-        string customer_unique_id
-        string customer_zip_code_prefix
-        string customer_city
-        string customer_state
-}
-
-    sellers {
-        string seller_id
-        string seller_zip_code_prefix
-        string seller_city
-        string seller_state
-}
-
-    products {
-        string product_id
-        string product_category_name
-        int product_name_length
-        int product_description_length
-        int product_photos_qty
-        float product_weight_g
-        float product_length_cm
-        float product_height_cm
-        float product_width_cm
-}
-
-    geolocation {
-        string geolocation_zip_code_prefix
-        float geolocation_lat
-        float geolocation_lng
-        string geolocation_city
-        string geolocation_state
+	questions := defaultQuestions
+	switch {
+	case *question != "":
+		questions = []string{*question}
+	case *questionFile != "":
+		if questions, err = readQuestions(*questionFile); err != nil {
+			log.Fatalf("Error reading questions: %v", err)
+		}
+	}
 
-}`
+	prices := structuredoutput.DefaultPrices
+	if *pricesFile != "" {
+		if prices, err = structuredoutput.LoadPriceTable(*pricesFile); err != nil {
+			log.Fatalf("Error loading prices: %v", err)
+		}
+	}
 
-func main() {
+	usage := structuredoutput.NewUsageTracker()
+	chatOpts := []structuredoutput.Option{structuredoutput.WithTimeout(*timeout), structuredoutput.WithUsage(usage)}
+	if *provider != "" {
+		p, err := structuredoutput.NewProvider(*provider)
+		if err != nil {
+			log.Fatal(err)
+		}
+		chatOpts = append(chatOpts, structuredoutput.WithProvider(p))
+	}
+	if *model != "" {
+		chatOpts = append(chatOpts, structuredoutput.WithModel(*model))
+	}
+	var fallback *structuredoutput.FallbackProvider
+	if *fallbackChain != "" {
+		if fallback, err = newFallbackProvider(*provider, *model, *fallbackChain, *timeout); err != nil {
+			log.Fatal(err)
+		}
+		// Every model gets -timeout, so the conversation waits for the whole chain.
+		chatOpts = append(chatOpts, structuredoutput.WithProvider(fallback), structuredoutput.WithTimeout(*timeout*time.Duration(len(fallback.Stats()))))
+	}
+	if *rpm > 0 || *tpm > 0 {
+		chatOpts = append(chatOpts, structuredoutput.WithRateLimiter(structuredoutput.NewRateLimiter(*rpm, *tpm)))
+	}
+	if *cacheFile != "" {
+		cache, err := structuredoutput.NewSQLiteCache(*cacheFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cache.Close()
+		chatOpts = append(chatOpts, structuredoutput.WithCache(cache, *cacheTTL))
+		if *cacheBypass {
+			chatOpts = append(chatOpts, structuredoutput.WithCacheBypass())
+		}
+	}
 
-	type Example struct {
-		Question string
-		Answer   string
-	}
-	examples := []Example{
-		{
-			Question: "Which seller has delivered the most orders to customers in Rio de Janeiro? [string: seller_id]",
-			Answer:   "SELECT s.seller_id, COUNT(*) AS order_count FROM orders o JOIN customers c ON o.customer_id = c.customer_id JOIN sellers s ON o.seller_id = s.seller_id WHERE c.customer_city = 'rio de janeiro' AND o.order_status = 'delivered' GROUP BY s.seller_id ORDER BY order_count DESC LIMIT 1;",
-		},
-		{
-			Question: "What's the average review score for 'beleza_saude' products?",
-			Answer:   "SELECT AVG(r.review_score) AS avg_score FROM order_reviews r JOIN order_items oi ON r.order_id = oi.order_id JOIN products p ON oi.product_id = p.product_id WHERE p.product_category_name = 'beleza_saude';",
-		},
+	if *memoryBudget > 0 {
+		var strategy structuredoutput.MemoryStrategy = structuredoutput.SlidingWindow{}
+		if *summarize {
+			strategy = structuredoutput.Summarize{Options: append([]structuredoutput.Option{}, chatOpts...)}
+		}
+		chatOpts = append(chatOpts, structuredoutput.WithMemoryBudget(*memoryBudget, strategy))
 	}
 
-	testCases := []string{
-		"Which seller has delivered the most orders to customers in Rio de Janeiro? [string: seller_id]",
-		// "What's the average review score for products in the 'beleza_saude' category? [float: score]",
-		// "How many sellers have completed orders worth more than 100,000 BRL in total? [integer: count]",
-		// "Which product category has the highest rate of 5 - star reviews ? [string: category_name]",
-		// "What's the most common payment installment count for orders over 1000 BRL? [integer: installments]",
-		// "Which city has the highest average freight value per order? [string: city_name]",
-		// "What's the most expensive product category based on average price? [string: category_name]",
-		// "Which product category has the shortest average delivery time? [string: category_name]",
-		// "How many unique customers have placed orders in the state of Sao Paulo? [integer: count]",
-		// "What percentage of orders are delivered before the estimated delivery date ? [float: percentage]"
+	agent := text2sql.NewAgent(chatOpts...)
+	agent.SchemaFormat = *schemaFormat
+	agent.Repair.MaxRounds = *repairs
+	if *promptsDir != "" {
+		if err := agent.Prompts.Load(os.DirFS(*promptsDir)); err != nil {
+			log.Fatalf("Error loading prompts: %v", err)
+		}
+	}
+	if *promptVersion != "" {
+		if err := agent.Prompts.Use(text2sql.SystemPromptName, *promptVersion); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *stream {
+		agent.OnStream = printProgress
 	}
-	failedgenerations := 0
-	for caseId, testCase := range testCases {
 
-		conv := structuredoutput.NewChatContext(caseId)
+	db, err := text2sql.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
 
-		// Add system message to the conversation
-		// This message is used to set the context for the conversation
-		// Explains the role of the assistant, and introduces to the database schema
-		// and the task at hand
-		conv.AddMessage(openai.ChatCompletionMessageParamUnion{
-			OfSystem: &openai.ChatCompletionSystemMessageParam{
-				Content: openai.ChatCompletionSystemMessageParamContentUnion{
-					OfString: openai.String(initialContext),
-				},
-			},
-		})
+	var examples []text2sql.Example
+	switch {
+	case *examplesFile != "":
+		examples, err = text2sql.LoadExamples(*examplesFile)
+	case *examplesTable != "":
+		examples, err = text2sql.LoadExamplesFromDB(context.Background(), db, *examplesTable)
+	}
+	if err != nil {
+		log.Fatalf("Error loading examples: %v", err)
+	}
+	if examples != nil {
+		agent.Examples = examples
+		agent.MaxExamples = *maxExamples
+	}
+	if err := verifyExamples(agent, db, *verify, *examplesEval); err != nil {
+		log.Fatal(err)
+	}
+	if examples != nil {
+		agent.Selector = text2sql.NewBM25Selector(agent.Examples)
+	}
 
-		// few-short learning
-		for _, example := range examples {
-			conv.AddMessage(openai.ChatCompletionMessageParamUnion{
-				OfUser: &openai.ChatCompletionUserMessageParam{
-					Content: openai.ChatCompletionUserMessageParamContentUnion{
-						OfString: openai.String(example.Question),
-					},
-				},
-			})
-			conv.AddMessage(openai.ChatCompletionMessageParamUnion{
-				OfAssistant: &openai.ChatCompletionAssistantMessageParam{
-					Content: openai.ChatCompletionAssistantMessageParamContentUnion{
-						OfString: openai.String(example.Answer),
-					},
-				},
-			})
+	if *evalFile != "" {
+		if err := runEval(agent, db, *evalFile, *format, prices, *workers); err != nil {
+			log.Fatal(err)
 		}
+		printFallbackStats(fallback)
+		return
+	}
 
-		// user question
-		conv.AddMessage(openai.ChatCompletionMessageParamUnion{
-			OfUser: &openai.ChatCompletionUserMessageParam{
-				Content: openai.ChatCompletionUserMessageParamContentUnion{
-					OfString: openai.String(testCase),
-				},
-			},
-		})
-
-		// Uncomment this line to view the conversation
-		// conv.ViewConversation()
-
-		resp, err := conv.GenerateResponseFromModel(respSchema)
-		if err != nil {
-			log.Printf("Error generating response: %v", err)
-			continue
+	ask := func(q string) (text2sql.Answer, error) {
+		return agent.Ask(context.Background(), db, q)
+	}
+	if *session != "" {
+		// Follow-up questions build on the earlier answers.
+		*workers = 1
+		store := structuredoutput.NewJSONLStore(*session)
+		conv, err := structuredoutput.ResumeChatContext(context.Background(), store, *sessionID, agent.ChatOptions...)
+		if errors.Is(err, structuredoutput.ErrConversationNotFound) {
+			conv = structuredoutput.NewChatContext(*sessionID, agent.ChatOptions...)
+		} else if err != nil {
+			log.Fatalf("Error resuming session: %v", err)
 		}
-		var response structuredoutput.ModelResp
-		if err := json.Unmarshal([]byte(resp), &response); err != nil {
-			log.Printf("Error unmarshalling response: %v", err)
-			continue
+		ask = func(q string) (text2sql.Answer, error) {
+			answer, err := agent.Continue(context.Background(), conv, db, q)
+			if serr := conv.Save(context.Background(), store); serr != nil {
+				log.Printf("Error saving session: %v", serr)
+			}
+			return answer, err
 		}
+	}
 
-		var agentResp AgentResponseFormat
-		json.Unmarshal([]byte(response.Content), &agentResp)
-		fmt.Printf("User query : %s\n", testCase)
-		for i, step := range agentResp.Steps {
-			fmt.Printf("Step %d:\n", i+1)
-			fmt.Printf("Explanation:\n %s\n", step.Explanation)
-		}
-		fmt.Printf("Final Output:\n%s\n", agentResp.FinalOutput)
-		// execute the SQL query
-		results, err := ExecuteSQLQuery("/Users/adash/personal/ai-dojo/olist.sqlite", agentResp.FinalOutput)
+	failedgenerations := 0
+	write := func(q string, answer text2sql.Answer, err error, elapsed time.Duration) {
 		if err != nil {
-			log.Printf("Error executing SQL query: %v", err)
+			log.Printf("Error answering %q: %v", q, err)
 			failedgenerations++
-			continue
 		}
-
-		fmt.Printf("result: %+v\n", results)
-		fmt.Println("--------------------------------------------------")
-
+		if werr := out.Write(answer, err, elapsed); werr != nil {
+			log.Fatalf("Error writing output: %v", werr)
+		}
 	}
-	fmt.Printf("Failed generations: %d\n", failedgenerations)
-	fmt.Printf("Total test cases: %d\n", len(testCases))
-	fmt.Printf("Success rate: %.2f%%\n", (1-float64(failedgenerations)/float64(len(testCases)))*100)
-	fmt.Println("--------------------------------------------------")
+	if *workers > 1 {
+		results := structuredoutput.RunBatch(context.Background(), questions, *workers, func(_ context.Context, q string) (text2sql.Answer, error) {
+			return ask(q)
+		})
+		for i, r := range results {
+			write(questions[i], r.Value, r.Err, r.Elapsed)
+		}
+	} else {
+		for _, q := range questions {
+			start := time.Now()
+			answer, err := ask(q)
+			write(q, answer, err, time.Since(start))
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatalf("Error writing output: %v", err)
+	}
+
+	// The summary goes to stderr so that json and csv output stay machine readable.
+	fmt.Fprintf(os.Stderr, "Failed generations: %d\n", failedgenerations)
+	fmt.Fprintf(os.Stderr, "Total test cases: %d\n", len(questions))
+	fmt.Fprintf(os.Stderr, "Success rate: %.2f%%\n", (1-float64(failedgenerations)/float64(len(questions)))*100)
+	fmt.Fprintf(os.Stderr, "Usage: %s\n", usage.Total())
+	fmt.Fprintf(os.Stderr, "Estimated cost: %s\n", structuredoutput.FormatCost(usage.Cost(prices)))
+	printFallbackStats(fallback)
 }
 
-func ExecuteSQLQuery(dbPath string, query string) ([]map[string]interface{}, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// newFallbackProvider chains the model given by -provider and -model with the
+// provider:model pairs of chain, each bounded by timeout.
+func newFallbackProvider(provider, model, chain string, timeout time.Duration) (*structuredoutput.FallbackProvider, error) {
+	primary, err := structuredoutput.NewProvider(provider)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
-	defer db.Close()
+	targets := []structuredoutput.FallbackTarget{{Provider: primary, Model: model, Timeout: timeout}}
+	for _, pair := range strings.Split(chain, ",") {
+		name, model, _ := strings.Cut(strings.TrimSpace(pair), ":")
+		p, err := structuredoutput.NewProvider(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -fallback %q: %w", pair, err)
+		}
+		targets = append(targets, structuredoutput.FallbackTarget{Provider: p, Model: model, Timeout: timeout})
+	}
+	return structuredoutput.NewFallbackProvider(targets...), nil
+}
 
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+// printFallbackStats shows on stderr which models served the calls, if there is a fallback chain.
+func printFallbackStats(fallback *structuredoutput.FallbackProvider) {
+	if fallback == nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Models:")
+	for _, s := range fallback.Stats() {
+		fmt.Fprintf(os.Stderr, "  %s: served %d, failures %v, skipped %d\n", s.Target, s.Served, s.Failures, s.Skipped)
 	}
-	defer rows.Close()
+}
 
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+// verifyExamples drops the agent's examples whose SQL does not work against db
+// and, if evalPath is set, saves the verified results as eval cases.
+func verifyExamples(agent *text2sql.Agent, db *sql.DB, mode string, evalPath string) error {
+	opts := text2sql.VerifyOptions{Limits: agent.Limits}
+	switch {
+	case evalPath != "":
+		opts.Execute = true
+	case mode == "off":
+		return nil
+	case mode == "execute":
+		opts.Execute = true
+	case mode != "explain":
+		return fmt.Errorf("unknown -verify-examples mode %q (want explain, execute or off)", mode)
 	}
 
-	var results []map[string]interface{}
-	for rows.Next() {
-		columnPointers := make([]interface{}, len(columns))
-		columnValues := make([]interface{}, len(columns))
-		for i := range columnValues {
-			columnPointers[i] = &columnValues[i]
+	checks := text2sql.VerifyExamples(context.Background(), db, agent.Examples, opts)
+	var cases []text2sql.EvalCase
+	for i, check := range checks {
+		if !check.OK() {
+			log.Printf("Skipping broken example %q: %s", check.Example.Question, check.Error)
+			continue
 		}
-
-		if err := rows.Scan(columnPointers...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+		if c, ok := check.EvalCase(fmt.Sprintf("example-%d", i+1)); ok {
+			cases = append(cases, c)
 		}
+	}
+	agent.Examples = text2sql.VerifiedExamples(checks)
+
+	if evalPath == "" {
+		return nil
+	}
+	f, err := os.Create(evalPath)
+	if err != nil {
+		return fmt.Errorf("failed to create eval file: %w", err)
+	}
+	if err := text2sql.WriteEvalCases(f, cases); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-		rowMap := make(map[string]interface{})
-		for i, colName := range columns {
-			rowMap[colName] = columnValues[i]
+// runEval scores the agent on an eval dataset and prints the report to stdout.
+func runEval(agent *text2sql.Agent, db *sql.DB, path string, format string, prices structuredoutput.PriceTable, workers int) error {
+	cases, err := text2sql.LoadEvalCases(path)
+	if err != nil {
+		return fmt.Errorf("failed to load eval dataset: %w", err)
+	}
+	opts := text2sql.DefaultEvalOptions
+	opts.Prices = prices
+	opts.Workers = workers
+	report := text2sql.RunEval(context.Background(), agent, db, cases, opts)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
 		}
-		results = append(results, rowMap)
+	} else {
+		fmt.Print(report.Markdown())
 	}
+	fmt.Fprintf(os.Stderr, "Execution accuracy: %.2f%%\n", report.ExecutionAccuracy*100)
+	fmt.Fprintf(os.Stderr, "Usage: %s\n", report.TotalUsage())
+	fmt.Fprintf(os.Stderr, "Estimated cost: %s\n", structuredoutput.FormatCost(report.Cost, report.Unpriced))
+	return nil
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+func readQuestions(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	return results, nil
+	var questions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		questions = append(questions, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("%s contains no questions", path)
+	}
+	return questions, nil
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"llmdojo/text2sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAnswer = text2sql.Answer{
+	Question: "Which seller sold the most?",
+	Response: text2sql.AgentResponseFormat{
+		Steps:       []text2sql.Step{{Explanation: "Count orders per seller."}},
+		FinalOutput: "SELECT seller_id, COUNT(*) AS n FROM order_items GROUP BY seller_id",
+	},
+	ResultSet: text2sql.ResultSet{
+		Columns: []string{"seller_id", "n"},
+		Rows: []map[string]interface{}{
+			{"seller_id": "s1", "n": int64(2)},
+			{"seller_id": []byte("s2"), "n": nil},
+		},
+	},
+}
+
+func render(t *testing.T, format string, err error) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, ferr := newWriter(format, &buf)
+	if ferr != nil {
+		t.Fatalf("newWriter: %v", ferr)
+	}
+	if werr := w.Write(testAnswer, err, time.Second); werr != nil {
+		t.Fatalf("Write: %v", werr)
+	}
+	if werr := w.Flush(); werr != nil {
+		t.Fatalf("Flush: %v", werr)
+	}
+	return buf.String()
+}
+
+func TestCSVOutput(t *testing.T) {
+	want := "question,seller_id,n\nWhich seller sold the most?,s1,2\nWhich seller sold the most?,s2,\n"
+	if got := render(t, "csv", nil); got != want {
+		t.Errorf("Unexpected CSV:\n%s", got)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	var records []map[string]interface{}
+	if err := json.Unmarshal([]byte(render(t, "json", errors.New("boom"))), &records); err != nil {
+		t.Fatalf("Invalid JSON output: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got: %d", len(records))
+	}
+	for _, key := range []string{"question", "response", "columns", "rows", "error", "elapsedMs"} {
+		if _, ok := records[0][key]; !ok {
+			t.Errorf("JSON record is missing %q", key)
+		}
+	}
+}
+
+func TestTableOutput(t *testing.T) {
+	got := render(t, "table", nil)
+	for _, want := range []string{"User query : Which seller sold the most?", "seller_id  n", "s1         2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Table output is missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := newWriter("xml", &bytes.Buffer{}); err == nil {
+		t.Fatal("Expected error for unknown format")
+	}
+}
+
+func TestNewFallbackProvider(t *testing.T) {
+	fallback, err := newFallbackProvider("ollama", "qwen2.5", "ollama:llama3.2, openai:gpt-4o-mini", time.Second)
+	if err != nil {
+		t.Fatalf("newFallbackProvider: %v", err)
+	}
+	var targets []string
+	for _, s := range fallback.Stats() {
+		targets = append(targets, s.Target)
+	}
+	if got := strings.Join(targets, " "); got != "ollama/qwen2.5 ollama/llama3.2 openai/gpt-4o-mini" {
+		t.Errorf("Unexpected chain: %s", got)
+	}
+
+	if _, err := newFallbackProvider("ollama", "", "bogus:model", time.Second); err == nil {
+		t.Fatal("Expected error for unknown provider")
+	}
+}
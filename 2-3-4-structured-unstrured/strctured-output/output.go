@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	structuredoutput "llmdojo"
+	"llmdojo/text2sql"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// answerWriter renders answers in one of the CLI output formats.
+type answerWriter interface {
+	Write(answer text2sql.Answer, err error, elapsed time.Duration) error
+	Flush() error
+}
+
+func newWriter(format string, w io.Writer) (answerWriter, error) {
+	switch format {
+	case "table":
+		return &tableWriter{w: w}, nil
+	case "json":
+		return &jsonWriter{w: w}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (want table, json or csv)", format)
+	}
+}
+
+// formatValue renders a SQLite value for text output.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// printProgress shows the steps and the query on stderr as the model writes them.
+func printProgress(event structuredoutput.StreamEvent) {
+	for _, field := range event.Fields {
+		switch {
+		case strings.HasPrefix(field.Path, "steps[") && strings.HasSuffix(field.Path, "].explanation"):
+			fmt.Fprintf(os.Stderr, "  - %s\n", field.Text())
+		case field.Path == "finalOutput":
+			fmt.Fprintf(os.Stderr, "  SQL: %s\n", field.Text())
+		}
+	}
+}
+
+// tableWriter prints the reasoning, the query and the rows for people to read.
+type tableWriter struct {
+	w io.Writer
+}
+
+func (t *tableWriter) Write(answer text2sql.Answer, err error, elapsed time.Duration) error {
+	fmt.Fprintf(t.w, "User query : %s\n", answer.Question)
+	for i, step := range answer.Response.Steps {
+		fmt.Fprintf(t.w, "Step %d:\n", i+1)
+		fmt.Fprintf(t.w, "Explanation:\n %s\n", step.Explanation)
+	}
+	for i, repair := range answer.Repairs {
+		fmt.Fprintf(t.w, "Repair %d:\n %s\n error: %s\n", i+1, repair.Query, repair.Error)
+	}
+	fmt.Fprintf(t.w, "Final Output:\n%s\n", answer.Response.FinalOutput)
+	if err != nil {
+		fmt.Fprintf(t.w, "Error: %v\n", err)
+	} else {
+		tw := tabwriter.NewWriter(t.w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(answer.Columns, "\t"))
+		for _, row := range answer.Rows {
+			values := make([]string, len(answer.Columns))
+			for i, col := range answer.Columns {
+				values[i] = formatValue(row[col])
+			}
+			fmt.Fprintln(tw, strings.Join(values, "\t"))
+		}
+		if ferr := tw.Flush(); ferr != nil {
+			return ferr
+		}
+	}
+	fmt.Fprintf(t.w, "Took: %s\n", elapsed.Round(time.Millisecond))
+	_, werr := fmt.Fprintln(t.w, "--------------------------------------------------")
+	return werr
+}
+
+func (t *tableWriter) Flush() error {
+	return nil
+}
+
+type jsonAnswer struct {
+	text2sql.Answer
+	Error     string `json:"error,omitempty"`
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// jsonWriter collects the answers and writes them as one JSON array.
+type jsonWriter struct {
+	w       io.Writer
+	answers []jsonAnswer
+}
+
+func (j *jsonWriter) Write(answer text2sql.Answer, err error, elapsed time.Duration) error {
+	record := jsonAnswer{Answer: answer, ElapsedMs: elapsed.Milliseconds()}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	j.answers = append(j.answers, record)
+	return nil
+}
+
+func (j *jsonWriter) Flush() error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(j.answers)
+}
+
+// csvWriter writes each answer's rows prefixed with the question.
+// Every answer starts with its own header row since questions select different columns.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(answer text2sql.Answer, err error, elapsed time.Duration) error {
+	if err != nil {
+		return c.w.WriteAll([][]string{{"question", "error"}, {answer.Question, err.Error()}})
+	}
+	if werr := c.w.Write(append([]string{"question"}, answer.Columns...)); werr != nil {
+		return werr
+	}
+	for _, row := range answer.Rows {
+		record := []string{answer.Question}
+		for _, col := range answer.Columns {
+			record = append(record, formatValue(row[col]))
+		}
+		if werr := c.w.Write(record); werr != nil {
+			return werr
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,107 @@
+package structuredoutput
+
+import (
+	"context"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// StreamingProvider is a Provider that can send the answer as it is generated.
+// Providers without streaming are streamed as one piece.
+type StreamingProvider interface {
+	Provider
+	// ChatCompletionStream sends the request like ChatCompletion, calls onDelta
+	// with every piece of content as it arrives and returns the whole completion.
+	ChatCompletionStream(ctx context.Context, params openai.ChatCompletionNewParams, onDelta func(string)) (*openai.ChatCompletion, error)
+}
+
+// StreamEvent is a piece of a streamed answer.
+type StreamEvent struct {
+	// Completion counts the model calls of the stream. A new completion
+	// starts over after a tool call or a retry.
+	Completion int
+	Delta      string
+	// Fields are the JSON values Delta completed (see JSONStreamParser).
+	Fields []FieldEvent
+}
+
+// Stream is an answer being generated in the background.
+// The ChatContext must not be used until Wait returns.
+type Stream[T any] struct {
+	events chan StreamEvent
+	value  T
+	err    error
+}
+
+// Events returns the pieces of the answer. The channel is closed when the answer is done.
+func (s *Stream[T]) Events() <-chan StreamEvent {
+	return s.events
+}
+
+// Wait discards the events not read yet and returns the answer.
+func (s *Stream[T]) Wait() (T, error) {
+	for range s.events {
+	}
+	return s.value, s.err
+}
+
+// GenerateStream is Generate with the answer streamed over Stream.Events.
+func GenerateStream[T any](ctx context.Context, c *ChatContext, opts GenerateOptions) *Stream[T] {
+	s := &Stream[T]{events: make(chan StreamEvent)}
+	go func() {
+		defer close(s.events)
+		s.value, s.err = generate[T](ctx, c, opts, &streamSink{events: s.events})
+	}()
+	return s
+}
+
+// GenerateResponseFromModelStream is GenerateResponseFromModelContext with the
+// answer streamed over Stream.Events.
+func (c *ChatContext) GenerateResponseFromModelStream(ctx context.Context, respSchema shared.ResponseFormatJSONSchemaJSONSchemaParam) *Stream[Completion] {
+	s := &Stream[Completion]{events: make(chan StreamEvent)}
+	go func() {
+		defer close(s.events)
+		s.value, s.err = c.complete(ctx, respSchema, &streamSink{events: s.events})
+	}()
+	return s
+}
+
+// streamSink turns the content deltas of a conversation's completions into StreamEvents.
+type streamSink struct {
+	events     chan<- StreamEvent
+	completion int
+}
+
+// stream makes one model call, sending its deltas to the sink.
+func (s *streamSink) stream(ctx context.Context, p Provider, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	parser := NewJSONStreamParser()
+	onDelta := func(delta string) {
+		s.send(ctx, StreamEvent{Completion: s.completion, Delta: delta, Fields: parser.Feed(delta)})
+	}
+	defer func() { s.completion++ }()
+
+	if sp, ok := p.(StreamingProvider); ok {
+		return sp.ChatCompletionStream(ctx, params, onDelta)
+	}
+	resp, err := p.ChatCompletion(ctx, params)
+	if err == nil && len(resp.Choices) > 0 && resp.Choices[0].Message.Content != "" {
+		onDelta(resp.Choices[0].Message.Content)
+	}
+	return resp, err
+}
+
+// replay sends a completion that was not requested, e.g. a cached one, as one delta.
+func (s *streamSink) replay(ctx context.Context, resp *openai.ChatCompletion) {
+	defer func() { s.completion++ }()
+	if content := resp.Choices[0].Message.Content; content != "" {
+		s.send(ctx, StreamEvent{Completion: s.completion, Delta: content, Fields: NewJSONStreamParser().Feed(content)})
+	}
+}
+
+func (s *streamSink) send(ctx context.Context, event StreamEvent) {
+	select {
+	case s.events <- event:
+	case <-ctx.Done():
+	}
+}
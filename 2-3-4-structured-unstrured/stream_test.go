@@ -0,0 +1,136 @@
+package structuredoutput
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+type streamStep struct {
+	Explanation string `json:"explanation"`
+}
+
+type streamAnswer struct {
+	Steps       []streamStep `json:"steps"`
+	FinalOutput string       `json:"finalOutput"`
+}
+
+const streamContent = `{"steps": [{"explanation": "Find \"rio\", then count."}, {"explanation": "Sort {desc}."}], "finalOutput": "SELECT 1", "n": -1.5e3, "ok": true, "none": null}`
+
+func TestJSONStreamParser(t *testing.T) {
+	want := []FieldEvent{
+		{Path: "steps[0].explanation", Value: []byte(`"Find \"rio\", then count."`)},
+		{Path: "steps[0]", Value: []byte(`{"explanation": "Find \"rio\", then count."}`)},
+		{Path: "steps[1].explanation", Value: []byte(`"Sort {desc}."`)},
+		{Path: "steps[1]", Value: []byte(`{"explanation": "Sort {desc}."}`)},
+		{Path: "steps", Value: []byte(`[{"explanation": "Find \"rio\", then count."}, {"explanation": "Sort {desc}."}]`)},
+		{Path: "finalOutput", Value: []byte(`"SELECT 1"`)},
+		{Path: "n", Value: []byte(`-1.5e3`)},
+		{Path: "ok", Value: []byte(`true`)},
+		{Path: "none", Value: []byte(`null`)},
+	}
+
+	for _, size := range []int{1, 3, len(streamContent)} {
+		parser := NewJSONStreamParser()
+		var got []FieldEvent
+		for i := 0; i < len(streamContent); i += size {
+			end := min(i+size, len(streamContent))
+			got = append(got, parser.Feed(streamContent[i:end])...)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Feed in pieces of %d: expected %v, got: %v", size, want, got)
+		}
+	}
+
+	if text := want[0].Text(); text != `Find "rio", then count.` {
+		t.Errorf("Expected decoded text, got: %s", text)
+	}
+	if text := want[6].Text(); text != "-1.5e3" {
+		t.Errorf("Expected raw number, got: %s", text)
+	}
+}
+
+func TestJSONStreamParserEarlyFields(t *testing.T) {
+	parser := NewJSONStreamParser()
+	events := parser.Feed(`{"steps":[{"explanation":"one"},{"explanation":"tw`)
+	if len(events) != 2 || events[0].Path != "steps[0].explanation" {
+		t.Fatalf("Expected the first step before the answer is complete, got: %v", events)
+	}
+	events = parser.Feed(`o"}],"finalOutput":"SELECT 1"`)
+	if len(events) != 4 || events[3].Path != "finalOutput" {
+		t.Errorf("Expected finalOutput before the closing brace, got: %v", events)
+	}
+}
+
+func TestGenerateStream(t *testing.T) {
+	fake := NewFakeProvider().On("streamAnswer", "",
+		FakeResponse{Content: `{"steps":[{"explanation":"one"}],"sql":"SELECT 1"}`},
+		FakeResponse{Content: streamContent[:strings.Index(streamContent, `, "n"`)] + "}"},
+	)
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("explain"))
+
+	stream := GenerateStream[streamAnswer](context.Background(), conv, GenerateOptions{MaxRetries: 1})
+	var content [2]strings.Builder
+	var paths []string
+	for event := range stream.Events() {
+		content[event.Completion].WriteString(event.Delta)
+		for _, field := range event.Fields {
+			paths = append(paths, field.Path)
+		}
+		if len(event.Delta) > fakeChunkSize {
+			t.Errorf("Expected deltas of at most %d bytes, got: %q", fakeChunkSize, event.Delta)
+		}
+	}
+	answer, err := stream.Wait()
+	if err != nil {
+		t.Fatalf("GenerateStream: %v", err)
+	}
+	if answer.FinalOutput != "SELECT 1" || len(answer.Steps) != 2 {
+		t.Errorf("Unexpected answer: %+v", answer)
+	}
+
+	// The first answer does not match the schema and is retried.
+	if content[0].String() != `{"steps":[{"explanation":"one"}],"sql":"SELECT 1"}` {
+		t.Errorf("Unexpected first completion: %s", content[0].String())
+	}
+	if !strings.HasSuffix(content[1].String(), `"finalOutput": "SELECT 1"}`) {
+		t.Errorf("Unexpected second completion: %s", content[1].String())
+	}
+	if paths[0] != "steps[0].explanation" || paths[len(paths)-1] != "finalOutput" {
+		t.Errorf("Unexpected field order: %v", paths)
+	}
+	if got := len(conv.Memory.Messages); got != 4 {
+		t.Errorf("Expected the streamed answers in memory, got: %d messages", got)
+	}
+}
+
+// plainProvider hides the streaming support of the provider it wraps.
+type plainProvider struct {
+	Provider
+}
+
+func TestGenerateResponseFromModelStreamWithoutStreaming(t *testing.T) {
+	fake := NewFakeProvider().On("testAnswer", "", FakeResponse{Content: `{"value":42,"unit":"km"}`})
+	conv := NewChatContext(1, WithProvider(plainProvider{fake}))
+	conv.AddMessage(openai.UserMessage("how far?"))
+
+	stream := conv.GenerateResponseFromModelStream(context.Background(), ResponseSchema[testAnswer]("", ""))
+	var events []StreamEvent
+	for event := range stream.Events() {
+		events = append(events, event)
+	}
+	completion, err := stream.Wait()
+	if err != nil {
+		t.Fatalf("GenerateResponseFromModelStream: %v", err)
+	}
+	if completion.Content != `{"value":42,"unit":"km"}` {
+		t.Errorf("Unexpected content: %s", completion.Content)
+	}
+	if len(events) != 1 || events[0].Delta != completion.Content || len(events[0].Fields) != 2 {
+		t.Errorf("Expected the answer as one event, got: %+v", events)
+	}
+}
@@ -0,0 +1,390 @@
+package text2sql
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	structuredoutput "llmdojo"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EvalCase is one line of an eval dataset (JSON Lines).
+// The expected answer is given either as GoldSQL, which is run against the
+// database, or as GoldResult rows, optionally named by GoldColumns. Name the
+// hinted column there to compare only it and ignore helper columns.
+// ExpectedType defaults to the question's type hint, e.g. "[integer: count]".
+type EvalCase struct {
+	ID           string          `json:"id"`
+	Question     string          `json:"question"`
+	ExpectedType string          `json:"expectedType,omitempty"`
+	GoldSQL      string          `json:"goldSql,omitempty"`
+	GoldColumns  []string        `json:"goldColumns,omitempty"`
+	GoldResult   [][]interface{} `json:"goldResult,omitempty"`
+}
+
+// LoadEvalCases reads an eval dataset with one JSON EvalCase per line.
+// Blank lines are skipped and cases without an id are numbered.
+func LoadEvalCases(path string) ([]EvalCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []EvalCase
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var c EvalCase
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if c.Question == "" {
+			return nil, fmt.Errorf("%s:%d: missing question", path, line)
+		}
+		if c.GoldSQL == "" && c.GoldResult == nil {
+			return nil, fmt.Errorf("%s:%d: need goldSql or goldResult", path, line)
+		}
+		if c.ID == "" {
+			c.ID = strconv.Itoa(len(cases) + 1)
+		}
+		cases = append(cases, c)
+	}
+	return cases, scanner.Err()
+}
+
+// EvalOptions tune how results are compared and priced.
+type EvalOptions struct {
+	// Tolerance is the relative difference under which two numbers are equal.
+	Tolerance float64
+	// Prices estimate the cost of the run.
+	Prices structuredoutput.PriceTable
+	// Workers is the number of cases asked at once, DefaultBatchWorkers when zero.
+	// Share a RateLimiter in the agent's ChatOptions to stay within the provider's limits.
+	Workers int
+}
+
+var DefaultEvalOptions = EvalOptions{Tolerance: 1e-4, Prices: structuredoutput.DefaultPrices}
+
+// CaseResult is the outcome of one eval case.
+type CaseResult struct {
+	ID           string `json:"id"`
+	Question     string `json:"question"`
+	GoldSQL      string `json:"goldSql,omitempty"`
+	PredictedSQL string `json:"predictedSql"`
+	// Executed is set when the predicted query ran successfully.
+	Executed bool `json:"executed"`
+	// TypeOK is set when the result has the shape and type the question asks for.
+	TypeOK bool `json:"typeOk"`
+	// Correct is set when the result matches the gold result.
+	Correct   bool   `json:"correct"`
+	Reason    string `json:"reason,omitempty"`
+	Repairs   int    `json:"repairs"`
+	ElapsedMs int64  `json:"elapsedMs"`
+	// Usage covers the model calls for this case.
+	Usage structuredoutput.Usage `json:"usage"`
+	// Prompt is the system prompt version the case was asked with.
+	Prompt  string `json:"prompt,omitempty"`
+	byModel map[string]structuredoutput.Usage
+}
+
+// Report aggregates the results of an eval run.
+type Report struct {
+	Cases             []CaseResult `json:"cases"`
+	Total             int          `json:"total"`
+	Executed          int          `json:"executed"`
+	TypeOK            int          `json:"typeOk"`
+	Correct           int          `json:"correct"`
+	ExecutionAccuracy float64      `json:"executionAccuracy"`
+	// Usage is the usage of the run per model.
+	Usage map[string]structuredoutput.Usage `json:"usage"`
+	// Cost is the estimated cost of the run in USD, without the Unpriced models.
+	Cost     float64  `json:"cost"`
+	Unpriced []string `json:"unpriced,omitempty"`
+	// Prompts are the system prompt versions of the run, so results can be
+	// attributed to a prompt revision.
+	Prompts []string `json:"prompts"`
+}
+
+// RunEval asks every case with agent and scores the answers against the gold results.
+// Cases are asked by opts.Workers at once; the report keeps their order.
+func RunEval(ctx context.Context, agent *Agent, db *sql.DB, cases []EvalCase, opts EvalOptions) Report {
+	results := structuredoutput.RunBatch(ctx, cases, opts.Workers, func(ctx context.Context, c EvalCase) (CaseResult, error) {
+		usage := structuredoutput.NewUsageTracker()
+		tracked := *agent
+		tracked.ChatOptions = append(append([]structuredoutput.Option{}, agent.ChatOptions...), structuredoutput.WithUsage(usage))
+
+		result := evalCase(ctx, &tracked, db, c, opts)
+		result.Usage = usage.Total()
+		result.byModel = usage.ByModel()
+		return result, nil
+	})
+
+	usage := structuredoutput.NewUsageTracker()
+	var report Report
+	for i, r := range results {
+		result := r.Value
+		if r.Err != nil {
+			result = CaseResult{ID: cases[i].ID, Question: cases[i].Question, GoldSQL: cases[i].GoldSQL, Reason: r.Err.Error()}
+		}
+		result.ElapsedMs = r.Elapsed.Milliseconds()
+		for model, u := range result.byModel {
+			usage.Record(structuredoutput.CallUsage{Model: model, Usage: u})
+		}
+		report.add(result)
+	}
+	report.Usage = usage.ByModel()
+	report.Cost, report.Unpriced = usage.Cost(opts.Prices)
+	return report
+}
+
+// TotalUsage sums the usage of all models.
+func (r Report) TotalUsage() structuredoutput.Usage {
+	var total structuredoutput.Usage
+	for _, u := range r.Usage {
+		total = total.Add(u)
+	}
+	return total
+}
+
+func (r *Report) add(result CaseResult) {
+	r.Cases = append(r.Cases, result)
+	if result.Prompt != "" && !slices.Contains(r.Prompts, result.Prompt) {
+		r.Prompts = append(r.Prompts, result.Prompt)
+	}
+	r.Total++
+	if result.Executed {
+		r.Executed++
+	}
+	if result.TypeOK {
+		r.TypeOK++
+	}
+	if result.Correct {
+		r.Correct++
+	}
+	r.ExecutionAccuracy = float64(r.Correct) / float64(r.Total)
+}
+
+func evalCase(ctx context.Context, agent *Agent, db *sql.DB, c EvalCase, opts EvalOptions) CaseResult {
+	result := CaseResult{ID: c.ID, Question: c.Question, GoldSQL: c.GoldSQL}
+
+	gold, err := goldResult(ctx, db, c, agent.Limits)
+	if err != nil {
+		result.Reason = fmt.Sprintf("gold query failed: %v", err)
+		return result
+	}
+
+	answer, err := agent.Ask(ctx, db, c.Question)
+	result.PredictedSQL = answer.Response.FinalOutput
+	result.Prompt = answer.Prompt
+	result.Repairs = len(answer.Repairs)
+	// A query that ran but could not be repaired into the answer type still executed.
+	var typeErr *AnswerTypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		result.Reason = err.Error()
+		return result
+	}
+	result.Executed = true
+
+	hint, hasHint := ParseTypeHint(c.Question)
+	if c.ExpectedType != "" {
+		expected, err := ParseAnswerType(c.ExpectedType)
+		if err != nil {
+			result.Reason = err.Error()
+			return result
+		}
+		hint.Type, hint.List = expected.Type, expected.List
+		hasHint = true
+	}
+
+	result.TypeOK = true
+	if typeErr != nil {
+		result.TypeOK = false
+		result.Reason = err.Error()
+	} else if hasHint {
+		if _, err := Coerce(answer.ResultSet, hint); err != nil {
+			result.TypeOK = false
+			result.Reason = err.Error()
+		}
+	}
+
+	if ok, reason := compareResults(answer.ResultSet, gold, hint.Column, opts.Tolerance); !ok {
+		if result.Reason == "" {
+			result.Reason = reason
+		}
+		return result
+	}
+	result.Correct = true
+	return result
+}
+
+func goldResult(ctx context.Context, db *sql.DB, c EvalCase, limits QueryLimits) (ResultSet, error) {
+	if c.GoldSQL != "" {
+		return ExecuteSQLQuery(ctx, db, c.GoldSQL, limits)
+	}
+
+	// Gold rows are positional; unnamed columns get generic names.
+	gold := ResultSet{Columns: c.GoldColumns, Rows: []map[string]interface{}{}}
+	for i, values := range c.GoldResult {
+		if i == 0 && gold.Columns == nil {
+			for j := range values {
+				gold.Columns = append(gold.Columns, fmt.Sprintf("column%d", j+1))
+			}
+		}
+		if len(values) != len(gold.Columns) {
+			return gold, fmt.Errorf("gold result row %d has %d values, expected %d", i+1, len(values), len(gold.Columns))
+		}
+		row := map[string]interface{}{}
+		for j, v := range values {
+			row[gold.Columns[j]] = v
+		}
+		gold.Rows = append(gold.Rows, row)
+	}
+	return gold, nil
+}
+
+// compareResults reports whether two result sets hold the same rows in any order.
+// When both sets have the hinted column only that column is compared, so that
+// helper columns like counts next to the answer do not count as mistakes;
+// otherwise rows are compared by position.
+func compareResults(predicted ResultSet, gold ResultSet, column string, tolerance float64) (bool, string) {
+	if len(predicted.Rows) != len(gold.Rows) {
+		return false, fmt.Sprintf("expected %d rows, got %d", len(gold.Rows), len(predicted.Rows))
+	}
+
+	predictedColumns, goldColumns := predicted.Columns, gold.Columns
+	if p, g := findColumn(predicted, column), findColumn(gold, column); p != "" && g != "" {
+		predictedColumns, goldColumns = []string{p}, []string{g}
+	}
+	predictedRows := projectRows(predicted, predictedColumns)
+	goldRows := projectRows(gold, goldColumns)
+
+	used := make([]bool, len(goldRows))
+	for _, p := range predictedRows {
+		matched := false
+		for i, g := range goldRows {
+			if !used[i] && rowsEqual(p, g, tolerance) {
+				used[i] = true
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, fmt.Sprintf("row %v is not in the gold result", p)
+		}
+	}
+	return true, ""
+}
+
+// findColumn returns the name of column in result, matched case-insensitively,
+// or "" when result has no such column.
+func findColumn(result ResultSet, column string) string {
+	if column == "" {
+		return ""
+	}
+	for _, col := range result.Columns {
+		if strings.EqualFold(col, column) {
+			return col
+		}
+	}
+	return ""
+}
+
+func projectRows(result ResultSet, columns []string) [][]interface{} {
+	rows := make([][]interface{}, len(result.Rows))
+	for i, row := range result.Rows {
+		values := make([]interface{}, len(columns))
+		for j, col := range columns {
+			values[j] = normalizeValue(row[col])
+		}
+		rows[i] = values
+	}
+	return rows
+}
+
+func rowsEqual(a []interface{}, b []interface{}, tolerance float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !valuesEqual(a[i], b[i], tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+func valuesEqual(a interface{}, b interface{}, tolerance float64) bool {
+	fa, aNum := a.(float64)
+	fb, bNum := b.(float64)
+	if aNum && bNum {
+		return math.Abs(fa-fb) <= tolerance*math.Max(1, math.Max(math.Abs(fa), math.Abs(fb)))
+	}
+	return a == b
+}
+
+// normalizeValue maps SQLite and JSON values onto float64, string, bool or nil.
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
+
+// Markdown renders the report as a per-case table followed by the aggregate scores.
+func (r Report) Markdown() string {
+	var b strings.Builder
+	b.WriteString("| ID | Question | Executed | Type OK | Correct | Repairs | Notes |\n")
+	b.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, c := range r.Cases {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %d | %s |\n",
+			c.ID, markdownCell(c.Question), check(c.Executed), check(c.TypeOK), check(c.Correct), c.Repairs, markdownCell(c.Reason))
+	}
+	fmt.Fprintf(&b, "\n**Prompt:** %s  \n", strings.Join(r.Prompts, ", "))
+	fmt.Fprintf(&b, "**Execution accuracy:** %d/%d (%.2f%%)  \n", r.Correct, r.Total, r.ExecutionAccuracy*100)
+	fmt.Fprintf(&b, "**Executed:** %d/%d  \n", r.Executed, r.Total)
+	fmt.Fprintf(&b, "**Type OK:** %d/%d  \n", r.TypeOK, r.Total)
+	fmt.Fprintf(&b, "**Usage:** %s  \n", r.TotalUsage())
+	fmt.Fprintf(&b, "**Estimated cost:** %s\n", structuredoutput.FormatCost(r.Cost, r.Unpriced))
+	return b.String()
+}
+
+func check(ok bool) string {
+	if ok {
+		return "✅"
+	}
+	return "❌"
+}
+
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,260 @@
+package text2sql
+
+import (
+	"context"
+	"fmt"
+	structuredoutput "llmdojo"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunEval(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+
+	cases := []EvalCase{
+		{ID: "gold-sql", Question: sellerQuestion, GoldSQL: "SELECT seller_id FROM sellers WHERE seller_city = 'rio de janeiro'"},
+		{ID: "gold-result", Question: sellerQuestion, GoldResult: [][]interface{}{{"s2"}}},
+	}
+	report := RunEval(context.Background(), newTestAgent(fake), db, cases, DefaultEvalOptions)
+
+	if report.Total != 2 || report.Executed != 2 || report.TypeOK != 2 || report.Correct != 1 {
+		t.Errorf("Unexpected totals: %+v", report)
+	}
+	if len(report.Prompts) != 1 || report.Prompts[0] != "sql-system@v1" || report.Cases[0].Prompt != "sql-system@v1" {
+		t.Errorf("Expected the sql-system@v1 prompt, got: %v", report.Prompts)
+	}
+	if report.ExecutionAccuracy != 0.5 {
+		t.Errorf("Expected execution accuracy: 0.5, got: %v", report.ExecutionAccuracy)
+	}
+	if !report.Cases[0].Correct {
+		t.Errorf("Expected gold-sql to be correct, got: %s", report.Cases[0].Reason)
+	}
+	if report.Cases[1].Correct || report.Cases[1].Reason == "" {
+		t.Errorf("Expected gold-result to be wrong with a reason, got: %+v", report.Cases[1])
+	}
+	if !strings.Contains(report.Markdown(), "**Execution accuracy:** 1/2 (50.00%)") {
+		t.Errorf("Unexpected markdown report:\n%s", report.Markdown())
+	}
+
+	if report.Cases[0].Usage.Calls != 1 || report.Cases[0].Usage.PromptTokens == 0 {
+		t.Errorf("Expected the usage of one call per case, got: %+v", report.Cases[0].Usage)
+	}
+	if total := report.TotalUsage(); total.Calls != 2 || total != report.Usage["fake"] {
+		t.Errorf("Expected the run's usage under the fake model, got: %+v", report.Usage)
+	}
+	if report.Cost != 0 || len(report.Unpriced) != 1 || !strings.Contains(report.Markdown(), "no price for fake") {
+		t.Errorf("Expected the fake model to be unpriced, got: %v %v", report.Cost, report.Unpriced)
+	}
+}
+
+func TestRunEvalWrongAnswerType(t *testing.T) {
+	db := newTestDB(t)
+	agent := newTestAgent(structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer))
+	agent.Repair.MaxRounds = 1
+
+	// The seller query runs but does not return a count.
+	cases := []EvalCase{{ID: "count", Question: "How many sellers are there? [integer: count]", GoldSQL: "SELECT COUNT(*) AS count FROM sellers"}}
+	report := RunEval(context.Background(), agent, db, cases, DefaultEvalOptions)
+
+	c := report.Cases[0]
+	if !c.Executed || c.TypeOK || c.Correct {
+		t.Errorf("Expected an executed query of the wrong type, got: %+v", c)
+	}
+	if c.Repairs != 1 || !strings.Contains(c.Reason, "result is not a integer") {
+		t.Errorf("Expected the type error after one repair, got: %d %s", c.Repairs, c.Reason)
+	}
+}
+
+func TestRunEvalWorkers(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+
+	var cases []EvalCase
+	for i := range 12 {
+		cases = append(cases, EvalCase{ID: fmt.Sprint(i), Question: sellerQuestion, GoldColumns: []string{"seller_id"}, GoldResult: [][]interface{}{{"s1"}}})
+	}
+	opts := DefaultEvalOptions
+	opts.Workers = 4
+	report := RunEval(context.Background(), newTestAgent(fake), db, cases, opts)
+
+	if report.Total != 12 || report.Correct != 12 {
+		t.Errorf("Unexpected totals: %+v", report)
+	}
+	for i, c := range report.Cases {
+		if c.ID != fmt.Sprint(i) || c.Usage.Calls != 1 {
+			t.Errorf("Expected case %d with one call, got: %s %+v", i, c.ID, c.Usage)
+		}
+	}
+	if total := report.TotalUsage(); total.Calls != 12 {
+		t.Errorf("Expected 12 calls in the run, got: %+v", total)
+	}
+}
+
+func TestRunEvalBrokenGold(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider()
+
+	cases := []EvalCase{{ID: "1", Question: sellerQuestion, GoldSQL: "SELECT missing FROM sellers"}}
+	report := RunEval(context.Background(), newTestAgent(fake), db, cases, DefaultEvalOptions)
+
+	if report.Correct != 0 || !strings.HasPrefix(report.Cases[0].Reason, "gold query failed") {
+		t.Errorf("Expected gold query failure, got: %+v", report.Cases[0])
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("Expected no model calls for a broken gold query, got: %d", len(fake.Calls()))
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	gold := ResultSet{
+		Columns: []string{"city", "total"},
+		Rows: []map[string]interface{}{
+			{"city": "rio de janeiro", "total": int64(3)},
+			{"city": "sao paulo", "total": 10.0},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		predicted ResultSet
+		column    string
+		want      bool
+	}{
+		{
+			name: "other order",
+			predicted: ResultSet{Columns: []string{"c", "t"}, Rows: []map[string]interface{}{
+				{"c": "sao paulo", "t": int64(10)},
+				{"c": "rio de janeiro", "t": 3.0},
+			}},
+			want: true,
+		},
+		{
+			name: "within tolerance",
+			predicted: ResultSet{Columns: []string{"c", "t"}, Rows: []map[string]interface{}{
+				{"c": "rio de janeiro", "t": 3.00001},
+				{"c": "sao paulo", "t": 9.99999},
+			}},
+			want: true,
+		},
+		{
+			name: "wrong value",
+			predicted: ResultSet{Columns: []string{"c", "t"}, Rows: []map[string]interface{}{
+				{"c": "rio de janeiro", "t": 4.0},
+				{"c": "sao paulo", "t": 10.0},
+			}},
+			want: false,
+		},
+		{
+			name: "missing row",
+			predicted: ResultSet{Columns: []string{"c", "t"}, Rows: []map[string]interface{}{
+				{"c": "rio de janeiro", "t": 3.0},
+			}},
+			want: false,
+		},
+		{
+			name:   "hinted column only",
+			column: "city",
+			predicted: ResultSet{Columns: []string{"city", "n"}, Rows: []map[string]interface{}{
+				{"city": []byte("sao paulo"), "n": int64(1)},
+				{"city": "rio de janeiro", "n": int64(2)},
+			}},
+			want: true,
+		},
+		{
+			name:   "hinted column only in predicted",
+			column: "c",
+			predicted: ResultSet{Columns: []string{"c", "t"}, Rows: []map[string]interface{}{
+				{"c": "sao paulo", "t": int64(10)},
+				{"c": "rio de janeiro", "t": 3.0},
+			}},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, reason := compareResults(tt.predicted, gold, tt.column, DefaultEvalOptions.Tolerance); got != tt.want {
+				t.Errorf("Expected match: %v, got: %v (%s)", tt.want, got, reason)
+			}
+		})
+	}
+}
+
+func TestLoadEvalCases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "eval.jsonl")
+	data := `{"question":"How many sellers? [integer: count]","goldSql":"SELECT COUNT(*) FROM sellers"}
+
+{"id":"rio","question":"Which seller? [string: seller_id]","goldResult":[["s1"]]}
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadEvalCases(path)
+	if err != nil {
+		t.Fatalf("Error loading eval cases: %v", err)
+	}
+	if len(cases) != 2 || cases[0].ID != "1" || cases[1].ID != "rio" {
+		t.Errorf("Unexpected cases: %+v", cases)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"question":"No gold?"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEvalCases(path); err == nil {
+		t.Errorf("Expected an error for a case without gold")
+	}
+}
+
+func TestLoadSampleEvalCases(t *testing.T) {
+	cases, err := LoadEvalCases("../strctured-output/olist_eval.jsonl")
+	if err != nil {
+		t.Fatalf("Error loading sample dataset: %v", err)
+	}
+	for _, c := range cases {
+		if _, ok := ParseTypeHint(c.Question); !ok {
+			t.Errorf("Expected a type hint in %s", c.ID)
+		}
+		if err := CheckReadOnlyQuery(c.GoldSQL); err != nil {
+			t.Errorf("Gold query of %s is not read-only: %v", c.ID, err)
+		}
+	}
+
+	// A case asked among the few-shot examples would find its answer in the prompt.
+	examples, err := LoadExamples("../strctured-output/olist_examples.jsonl")
+	if err != nil {
+		t.Fatalf("Error loading sample examples: %v", err)
+	}
+	examples = append(examples, DefaultExamples...)
+	for _, c := range cases {
+		for _, e := range examples {
+			if sameQuestion(c.Question, e.Question) {
+				t.Errorf("Case %s overlaps the example %q", c.ID, e.Question)
+			}
+		}
+	}
+}
+
+// sameQuestion reports whether two questions share at least three quarters of
+// their words, ignoring type hints and stopwords.
+func sameQuestion(a, b string) bool {
+	words := func(q string) map[string]bool {
+		if i := strings.LastIndex(q, "["); i >= 0 {
+			q = q[:i]
+		}
+		set := map[string]bool{}
+		for _, tok := range tokenize(q) {
+			set[tok] = true
+		}
+		return set
+	}
+	wa, wb := words(a), words(b)
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	return 4*shared >= 3*(len(wa)+len(wb)-shared)
+}
@@ -0,0 +1,196 @@
+package text2sql
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// LoadExamples reads verified question/SQL pairs with one JSON Example per line.
+// Blank lines are skipped.
+func LoadExamples(path string) ([]Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var examples []Example
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var e Example
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if e.Question == "" || e.Answer == "" {
+			return nil, fmt.Errorf("%s:%d: need question and answer", path, line)
+		}
+		examples = append(examples, e)
+	}
+	return examples, scanner.Err()
+}
+
+// LoadExamplesFromDB reads examples from a SQLite table with question and answer columns.
+func LoadExamplesFromDB(ctx context.Context, db *sql.DB, table string) ([]Example, error) {
+	query := fmt.Sprintf(`SELECT question, answer FROM "%s"`, strings.ReplaceAll(table, `"`, `""`))
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load examples from %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var examples []Example
+	for rows.Next() {
+		var e Example
+		if err := rows.Scan(&e.Question, &e.Answer); err != nil {
+			return nil, fmt.Errorf("failed to scan example: %w", err)
+		}
+		examples = append(examples, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating examples: %w", err)
+	}
+	return examples, nil
+}
+
+// ExampleSelector picks the few-shot examples shown for a question.
+type ExampleSelector interface {
+	Select(question string, k int) []Example
+}
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// BM25Selector ranks examples by the BM25 similarity of their question to
+// the asked question. It is built once and safe for concurrent use.
+type BM25Selector struct {
+	examples []Example
+	terms    []map[string]int
+	lengths  []int
+	avgLen   float64
+	idf      map[string]float64
+}
+
+// NewBM25Selector indexes the questions of examples.
+func NewBM25Selector(examples []Example) *BM25Selector {
+	s := &BM25Selector{
+		examples: examples,
+		terms:    make([]map[string]int, len(examples)),
+		lengths:  make([]int, len(examples)),
+		idf:      map[string]float64{},
+	}
+
+	df := map[string]int{}
+	total := 0
+	for i, e := range examples {
+		tokens := tokenize(e.Question)
+		counts := map[string]int{}
+		for _, tok := range tokens {
+			counts[tok]++
+		}
+		for tok := range counts {
+			df[tok]++
+		}
+		s.terms[i] = counts
+		s.lengths[i] = len(tokens)
+		total += len(tokens)
+	}
+	if len(examples) > 0 {
+		s.avgLen = float64(total) / float64(len(examples))
+	}
+
+	n := float64(len(examples))
+	for tok, d := range df {
+		s.idf[tok] = math.Log(1 + (n-float64(d)+0.5)/(float64(d)+0.5))
+	}
+	return s
+}
+
+// Select returns the k examples most similar to question, best first.
+// Ties keep the store order, so with no overlap the first k examples are used.
+func (s *BM25Selector) Select(question string, k int) []Example {
+	if k > len(s.examples) {
+		k = len(s.examples)
+	}
+	if k <= 0 {
+		return nil
+	}
+
+	scores := make([]float64, len(s.examples))
+	for _, tok := range uniqueTokens(tokenize(question)) {
+		idf, ok := s.idf[tok]
+		if !ok {
+			continue
+		}
+		for i, counts := range s.terms {
+			tf := float64(counts[tok])
+			if tf == 0 {
+				continue
+			}
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(s.lengths[i])/s.avgLen)
+			scores[i] += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	}
+
+	order := make([]int, len(s.examples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	selected := make([]Example, k)
+	for i := range selected {
+		selected[i] = s.examples[order[i]]
+	}
+	return selected
+}
+
+// stopwords carry no signal for matching questions.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "by": true, "for": true,
+	"has": true, "have": true, "in": true, "is": true, "of": true, "on": true,
+	"or": true, "s": true, "the": true, "to": true, "what": true, "which": true,
+	"with": true, "how": true, "many": true, "much": true,
+}
+
+// tokenize lowercases text and splits it into words, keeping snake_case
+// identifiers such as beleza_saude intact.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	tokens := words[:0]
+	for _, w := range words {
+		if !stopwords[w] {
+			tokens = append(tokens, w)
+		}
+	}
+	return tokens
+}
+
+func uniqueTokens(tokens []string) []string {
+	seen := map[string]bool{}
+	unique := tokens[:0]
+	for _, tok := range tokens {
+		if !seen[tok] {
+			seen[tok] = true
+			unique = append(unique, tok)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,129 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	structuredoutput "llmdojo"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var storeExamples = []Example{
+	{Question: "How many orders were canceled? [integer: count]", Answer: "SELECT COUNT(*) FROM orders WHERE order_status = 'canceled';"},
+	{Question: "What's the average review score for 'beleza_saude' products?", Answer: "SELECT AVG(review_score) FROM order_reviews;"},
+	{Question: "Which state has the most sellers? [string: seller_state]", Answer: "SELECT seller_state FROM sellers GROUP BY seller_state ORDER BY COUNT(*) DESC LIMIT 1;"},
+	{Question: "Which seller has the most delivered orders? [string: seller_id]", Answer: "SELECT seller_id FROM order_items GROUP BY seller_id ORDER BY COUNT(*) DESC LIMIT 1;"},
+}
+
+func TestBM25Selector(t *testing.T) {
+	selector := NewBM25Selector(storeExamples)
+
+	tests := []struct {
+		question string
+		want     string
+	}{
+		{"What's the average review score for products in the 'beleza_saude' category? [float: score]", storeExamples[1].Question},
+		{"Which seller has delivered the most orders to customers in Rio de Janeiro? [string: seller_id]", storeExamples[3].Question},
+		{"How many sellers are in each state?", storeExamples[2].Question},
+	}
+	for _, tt := range tests {
+		got := selector.Select(tt.question, 1)
+		if len(got) != 1 || got[0].Question != tt.want {
+			t.Errorf("Select(%q): expected %q, got: %+v", tt.question, tt.want, got)
+		}
+	}
+
+	if got := selector.Select("unrelated words only", 2); len(got) != 2 || got[0] != storeExamples[0] || got[1] != storeExamples[1] {
+		t.Errorf("Expected store order without overlap, got: %+v", got)
+	}
+	if got := selector.Select("orders", 10); len(got) != len(storeExamples) {
+		t.Errorf("Expected all %d examples, got: %d", len(storeExamples), len(got))
+	}
+	if got := NewBM25Selector(nil).Select("orders", 3); len(got) != 0 {
+		t.Errorf("Expected no examples from an empty store, got: %+v", got)
+	}
+}
+
+func TestAskSelectsExamples(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+	agent := newTestAgent(fake)
+	agent.Selector = NewBM25Selector(storeExamples)
+	agent.MaxExamples = 1
+
+	if _, err := agent.Ask(context.Background(), db, sellerQuestion); err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	messages := fake.Calls()[0].Messages
+	if len(messages) != 4 {
+		t.Fatalf("Expected system prompt, one example pair and question, got: %d messages", len(messages))
+	}
+	if got := messages[1].OfUser.Content.OfString.Value; got != storeExamples[3].Question {
+		t.Errorf("Unexpected example: %q", got)
+	}
+}
+
+func TestLoadExamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "examples.jsonl")
+	data := `{"question":"How many orders?","answer":"SELECT COUNT(*) FROM orders;"}
+
+{"question":"How many sellers?","answer":"SELECT COUNT(*) FROM sellers;"}
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	examples, err := LoadExamples(path)
+	if err != nil {
+		t.Fatalf("Error loading examples: %v", err)
+	}
+	if len(examples) != 2 || examples[1].Answer != "SELECT COUNT(*) FROM sellers;" {
+		t.Errorf("Unexpected examples: %+v", examples)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"question":"No answer?"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadExamples(path); err == nil {
+		t.Errorf("Expected an error for an example without answer")
+	}
+}
+
+func TestLoadSampleExamples(t *testing.T) {
+	examples, err := LoadExamples("../strctured-output/olist_examples.jsonl")
+	if err != nil {
+		t.Fatalf("Error loading sample examples: %v", err)
+	}
+	for _, e := range examples {
+		if err := CheckReadOnlyQuery(e.Answer); err != nil {
+			t.Errorf("Example %q is not read-only: %v", e.Question, err)
+		}
+	}
+}
+
+func TestLoadExamplesFromDB(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "examples.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE examples (question TEXT, answer TEXT)`,
+		`INSERT INTO examples VALUES ('How many orders?', 'SELECT COUNT(*) FROM orders;')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	examples, err := LoadExamplesFromDB(context.Background(), db, "examples")
+	if err != nil {
+		t.Fatalf("Error loading examples: %v", err)
+	}
+	if len(examples) != 1 || examples[0].Question != "How many orders?" {
+		t.Errorf("Unexpected examples: %+v", examples)
+	}
+	if _, err := LoadExamplesFromDB(context.Background(), db, "missing"); err == nil {
+		t.Errorf("Expected an error for a missing table")
+	}
+}
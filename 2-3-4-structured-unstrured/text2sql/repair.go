@@ -0,0 +1,114 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	structuredoutput "llmdojo"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// RepairOptions bound the self-correction loop in Agent.Ask.
+type RepairOptions struct {
+	// MaxRounds is how many times a failing query is sent back to the model.
+	MaxRounds int
+	// ExplainPlan adds the EXPLAIN QUERY PLAN output to the feedback when SQLite can produce one.
+	ExplainPlan bool
+}
+
+// RepairAttempt records a query that failed and the feedback sent to the model.
+type RepairAttempt struct {
+	Query string `json:"query"`
+	Error string `json:"error"`
+	Plan  string `json:"plan,omitempty"`
+}
+
+// answer generates a query for the conversation's question, runs it and repairs it.
+func (a *Agent) answer(ctx context.Context, conv *structuredoutput.ChatContext, db *sql.DB, answer Answer) (Answer, error) {
+	agentResp, err := a.generateSQL(ctx, conv)
+	if err != nil {
+		return answer, err
+	}
+
+	for round := 0; ; round++ {
+		answer.Response = agentResp
+		result, err := ExecuteSQLQuery(ctx, db, agentResp.FinalOutput, a.Limits)
+		if err == nil {
+			answer.ResultSet = result
+			hint, ok := agentResp.expectedType(answer.Question)
+			if !ok {
+				return answer, nil
+			}
+			typed, terr := Coerce(result, hint)
+			if terr == nil {
+				answer.Typed = &typed
+				return answer, nil
+			}
+			err = terr
+		}
+		if round >= a.Repair.MaxRounds {
+			return answer, fmt.Errorf("query still failing after %d repair rounds: %w", round, err)
+		}
+
+		attempt := RepairAttempt{Query: agentResp.FinalOutput, Error: err.Error()}
+		// The plan only helps with queries SQLite rejected, not with results of the wrong shape.
+		var typeErr *AnswerTypeError
+		if a.Repair.ExplainPlan && !errors.As(err, &typeErr) {
+			attempt.Plan, _ = ExplainQueryPlan(ctx, db, agentResp.FinalOutput)
+		}
+		answer.Repairs = append(answer.Repairs, attempt)
+
+		conv.AddMessage(openai.UserMessage(repairPrompt(attempt, err)))
+		agentResp, err = a.generateSQL(ctx, conv)
+		if err != nil {
+			return answer, err
+		}
+	}
+}
+
+func repairPrompt(attempt RepairAttempt, err error) string {
+	var b strings.Builder
+	var typeErr *AnswerTypeError
+	if errors.As(err, &typeErr) {
+		b.WriteString("The query ran, but its result does not answer the question in the expected form.\n")
+	} else {
+		b.WriteString("The query failed when executed against SQLite.\n")
+	}
+	fmt.Fprintf(&b, "Query: %s\nError: %s\n", attempt.Query, attempt.Error)
+	if attempt.Plan != "" {
+		fmt.Fprintf(&b, "Query plan:\n%s\n", attempt.Plan)
+	}
+	b.WriteString("Check the schema, fix the query and respond with the corrected finalOutput.")
+	return b.String()
+}
+
+// ExplainQueryPlan returns SQLite's EXPLAIN QUERY PLAN output for query, one step per line.
+// The query must pass CheckReadOnlyQuery.
+func ExplainQueryPlan(ctx context.Context, db *sql.DB, query string) (string, error) {
+	if err := CheckReadOnlyQuery(query); err != nil {
+		return "", err
+	}
+
+	rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query)
+	if err != nil {
+		return "", fmt.Errorf("failed to explain query: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return "", fmt.Errorf("failed to scan query plan: %w", err)
+		}
+		lines = append(lines, detail)
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("error iterating query plan: %w", err)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,97 @@
+package text2sql
+
+import (
+	"context"
+	structuredoutput "llmdojo"
+	"strings"
+	"testing"
+)
+
+const brokenSellerAnswer = `{"steps":[{"explanation":"Join orders to sellers."}],"finalOutput":"SELECT s.seller_id, COUNT(*) AS order_count FROM orders o JOIN sellers s ON o.seller_id = s.seller_id GROUP BY s.seller_id ORDER BY order_count DESC LIMIT 1;"}`
+
+func TestAskRepairsQuery(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", brokenSellerAnswer, sellerAnswer)
+	agent := newTestAgent(fake)
+	agent.Repair = RepairOptions{MaxRounds: 2, ExplainPlan: true}
+
+	answer, err := agent.Ask(context.Background(), db, sellerQuestion)
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	if len(answer.Repairs) != 1 {
+		t.Fatalf("Expected 1 repair, got: %d", len(answer.Repairs))
+	}
+	if !strings.Contains(answer.Repairs[0].Error, "no such column") {
+		t.Errorf("Unexpected repair error: %s", answer.Repairs[0].Error)
+	}
+	if len(answer.Rows) != 1 || answer.Rows[0]["seller_id"] != "s1" {
+		t.Errorf("Unexpected rows: %+v", answer.Rows)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 model calls, got: %d", len(calls))
+	}
+	messages := calls[1].Messages
+	feedback := messages[len(messages)-1].OfUser.Content.OfString.Value
+	if !strings.Contains(feedback, "no such column: o.seller_id") {
+		t.Errorf("Feedback does not include the SQLite error: %q", feedback)
+	}
+}
+
+func TestAskRepairsAnswerType(t *testing.T) {
+	db := newTestDB(t)
+	allSellers := `{"steps":[{"explanation":"Count delivered orders per seller."}],"finalOutput":"SELECT oi.seller_id FROM order_items oi GROUP BY oi.seller_id"}`
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", allSellers, sellerAnswer)
+	agent := newTestAgent(fake)
+
+	answer, err := agent.Ask(context.Background(), db, sellerQuestion)
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	if len(answer.Repairs) != 1 || !strings.Contains(answer.Repairs[0].Error, "expected exactly one row, got 2") {
+		t.Fatalf("Unexpected repairs: %+v", answer.Repairs)
+	}
+	if answer.Repairs[0].Plan != "" {
+		t.Errorf("Expected no query plan for a result of the wrong shape, got: %q", answer.Repairs[0].Plan)
+	}
+	if answer.Typed == nil || answer.Typed.Value != "s1" {
+		t.Errorf("Unexpected typed answer: %+v", answer.Typed)
+	}
+
+	messages := fake.Calls()[1].Messages
+	feedback := messages[len(messages)-1].OfUser.Content.OfString.Value
+	if !strings.HasPrefix(feedback, "The query ran, but its result does not answer the question") {
+		t.Errorf("Unexpected feedback: %q", feedback)
+	}
+}
+
+func TestAskGivesUp(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", brokenSellerAnswer)
+	agent := newTestAgent(fake)
+	agent.Repair = RepairOptions{MaxRounds: 2}
+
+	answer, err := agent.Ask(context.Background(), db, sellerQuestion)
+	if err == nil {
+		t.Fatal("Expected error after exhausting repair rounds")
+	}
+	if len(answer.Repairs) != 2 {
+		t.Errorf("Expected 2 repairs in the trail, got: %d", len(answer.Repairs))
+	}
+	if len(fake.Calls()) != 3 {
+		t.Errorf("Expected 3 model calls, got: %d", len(fake.Calls()))
+	}
+}
+
+func TestExplainQueryPlan(t *testing.T) {
+	db := newTestDB(t)
+	plan, err := ExplainQueryPlan(context.Background(), db, "SELECT * FROM orders WHERE order_id = 'o1'")
+	if err != nil {
+		t.Fatalf("Error explaining query: %v", err)
+	}
+	if !strings.Contains(plan, "orders") {
+		t.Errorf("Unexpected plan: %q", plan)
+	}
+}
@@ -0,0 +1,281 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QueryLimits bound what a model generated query may do.
+type QueryLimits struct {
+	// MaxRows rejects queries returning more rows. Zero means no limit.
+	MaxRows int
+	// Timeout interrupts queries running longer. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultQueryLimits are applied by NewAgent.
+var DefaultQueryLimits = QueryLimits{
+	MaxRows: 1000,
+	Timeout: 30 * time.Second,
+}
+
+type RejectionReason string
+
+const (
+	RejectEmpty              RejectionReason = "empty_query"
+	RejectMultipleStatements RejectionReason = "multiple_statements"
+	RejectNotReadOnly        RejectionReason = "not_read_only"
+	RejectRowLimit           RejectionReason = "row_limit_exceeded"
+	RejectTimeout            RejectionReason = "timeout"
+)
+
+// QueryRejection explains why a query was not run or its result was discarded,
+// phrased so that it can be fed back to the model.
+type QueryRejection struct {
+	Reason RejectionReason
+	Detail string
+}
+
+func (r *QueryRejection) Error() string {
+	return fmt.Sprintf("query rejected (%s): %s", r.Reason, r.Detail)
+}
+
+// writeKeywords start statements that modify the database or the connection.
+// Transaction keywords are left out: they can only start a statement, which
+// the SELECT/WITH check already rejects, and END also closes CASE expressions.
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true,
+	"CREATE": true, "DROP": true, "ALTER": true, "ATTACH": true, "DETACH": true,
+	"PRAGMA": true, "VACUUM": true, "REINDEX": true,
+}
+
+// CheckReadOnlyQuery accepts exactly one SELECT or WITH ... SELECT statement.
+// It tokenizes the query (skipping string literals, quoted identifiers and
+// comments) and rejects additional statements and data-modifying keywords
+// outside of parentheses, where SQLite would treat them as a statement.
+func CheckReadOnlyQuery(query string) error {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return &QueryRejection{Reason: RejectNotReadOnly, Detail: err.Error()}
+	}
+
+	var statements [][]sqlToken
+	var current []sqlToken
+	for _, tok := range tokens {
+		if tok.kind == tokSemicolon {
+			if len(current) > 0 {
+				statements = append(statements, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, tok)
+	}
+	if len(current) > 0 {
+		statements = append(statements, current)
+	}
+
+	switch len(statements) {
+	case 0:
+		return &QueryRejection{Reason: RejectEmpty, Detail: "the query is empty"}
+	case 1:
+	default:
+		return &QueryRejection{Reason: RejectMultipleStatements, Detail: fmt.Sprintf("expected a single statement, got %d", len(statements))}
+	}
+
+	stmt := statements[0]
+	first := strings.ToUpper(stmt[0].text)
+	if stmt[0].kind != tokWord || (first != "SELECT" && first != "WITH") {
+		return &QueryRejection{Reason: RejectNotReadOnly, Detail: fmt.Sprintf("only SELECT or WITH statements are allowed, got %q", stmt[0].text)}
+	}
+
+	depth := 0
+	for i, tok := range stmt {
+		switch tok.kind {
+		case tokOpen:
+			depth++
+		case tokClose:
+			depth--
+		case tokWord:
+			word := strings.ToUpper(tok.text)
+			// REPLACE(...) and friends are function calls, not statements.
+			isCall := i+1 < len(stmt) && stmt[i+1].kind == tokOpen
+			if depth == 0 && writeKeywords[word] && !isCall {
+				return &QueryRejection{Reason: RejectNotReadOnly, Detail: fmt.Sprintf("%s statements are not allowed", word)}
+			}
+		}
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokQuoted
+	tokOpen
+	tokClose
+	tokSemicolon
+	tokOther
+)
+
+type sqlToken struct {
+	kind tokenKind
+	text string
+}
+
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closer := c
+			if c == '[' {
+				closer = ']'
+			}
+			j := i + 1
+			for {
+				k := strings.IndexByte(query[j:], closer)
+				if k < 0 {
+					return nil, fmt.Errorf("unterminated quoted text starting at offset %d", i)
+				}
+				j += k + 1
+				// A doubled quote is an escaped quote inside the literal.
+				if closer != ']' && j < len(query) && query[j] == closer {
+					j++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, sqlToken{tokQuoted, query[i:j]})
+			i = j
+		case c == '(':
+			tokens = append(tokens, sqlToken{tokOpen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, sqlToken{tokClose, ")"})
+			i++
+		case c == ';':
+			tokens = append(tokens, sqlToken{tokSemicolon, ";"})
+			i++
+		case isWordByte(c):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokWord, query[i:j]})
+			i = j
+		default:
+			tokens = append(tokens, sqlToken{tokOther, string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// Open opens the SQLite database at path read-only: the connection refuses
+// writes even for statements that slip past CheckReadOnlyQuery.
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&_query_only=true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// ResultSet holds the rows of a query with its columns in select order.
+type ResultSet struct {
+	Columns []string                 `json:"columns"`
+	Rows    []map[string]interface{} `json:"rows"`
+}
+
+// ExecuteSQLQuery runs a model generated query in a sandbox.
+// The query must pass CheckReadOnlyQuery and stay within limits; otherwise a
+// *QueryRejection describes what to fix. Open db with Open so that SQLite
+// itself also refuses writes.
+func ExecuteSQLQuery(ctx context.Context, db *sql.DB, query string, limits QueryLimits) (ResultSet, error) {
+	if err := CheckReadOnlyQuery(query); err != nil {
+		return ResultSet{}, err
+	}
+
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	result, err := queryRows(ctx, db, query, limits.MaxRows)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ResultSet{}, &QueryRejection{Reason: RejectTimeout, Detail: fmt.Sprintf("the query ran longer than %s", limits.Timeout)}
+	}
+	return result, err
+}
+
+func queryRows(ctx context.Context, db *sql.DB, query string, maxRows int) (ResultSet, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return ResultSet{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return ResultSet{}, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	var results []map[string]interface{}
+	for rows.Next() {
+		if maxRows > 0 && len(results) == maxRows {
+			return ResultSet{}, &QueryRejection{Reason: RejectRowLimit, Detail: fmt.Sprintf("the query returned more than %d rows; aggregate the result or add a LIMIT", maxRows)}
+		}
+
+		columnPointers := make([]interface{}, len(columns))
+		columnValues := make([]interface{}, len(columns))
+		for i := range columnValues {
+			columnPointers[i] = &columnValues[i]
+		}
+
+		if err := rows.Scan(columnPointers...); err != nil {
+			return ResultSet{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		rowMap := make(map[string]interface{})
+		for i, colName := range columns {
+			rowMap[colName] = columnValues[i]
+		}
+		results = append(results, rowMap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return ResultSet{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return ResultSet{Columns: columns, Rows: results}, nil
+}
@@ -0,0 +1,70 @@
+package text2sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckReadOnlyQuery(t *testing.T) {
+	allowed := []string{
+		"SELECT * FROM orders",
+		"select count(*) from orders;",
+		"WITH t AS (SELECT order_id FROM orders) SELECT * FROM t",
+		"SELECT REPLACE(customer_city, ' ', '_') FROM customers",
+		"SELECT CASE WHEN price > 10 THEN 'high' ELSE 'low' END AS band FROM order_items",
+		"SELECT 'DROP TABLE orders; --' AS s",
+		`SELECT "delete" FROM t -- DELETE FROM orders`,
+	}
+	for _, query := range allowed {
+		if err := CheckReadOnlyQuery(query); err != nil {
+			t.Errorf("%s: unexpected rejection: %v", query, err)
+		}
+	}
+
+	rejected := map[string]RejectionReason{
+		"":                            RejectEmpty,
+		" ; -- nothing":               RejectEmpty,
+		"DELETE FROM orders":          RejectNotReadOnly,
+		"SELECT 1; DROP TABLE orders": RejectMultipleStatements,
+		"WITH t AS (SELECT 1) DELETE FROM orders": RejectNotReadOnly,
+		"PRAGMA writable_schema = 1":              RejectNotReadOnly,
+		"ATTACH DATABASE 'x.db' AS x":             RejectNotReadOnly,
+		"SELECT 'unterminated":                    RejectNotReadOnly,
+	}
+	for query, reason := range rejected {
+		err := CheckReadOnlyQuery(query)
+		var rejection *QueryRejection
+		if !errors.As(err, &rejection) {
+			t.Errorf("%q: expected rejection, got %v", query, err)
+			continue
+		}
+		if rejection.Reason != reason {
+			t.Errorf("%q: expected reason %s, got %s", query, reason, rejection.Reason)
+		}
+	}
+}
+
+func TestExecuteSQLQueryContextLimits(t *testing.T) {
+	db := newTestDB(t)
+
+	_, err := ExecuteSQLQuery(context.Background(), db, "SELECT * FROM orders", QueryLimits{MaxRows: 2})
+	var rejection *QueryRejection
+	if !errors.As(err, &rejection) || rejection.Reason != RejectRowLimit {
+		t.Errorf("expected row limit rejection, got %v", err)
+	}
+
+	infinite := "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT COUNT(*) FROM c"
+	_, err = ExecuteSQLQuery(context.Background(), db, infinite, QueryLimits{Timeout: 50 * time.Millisecond})
+	if !errors.As(err, &rejection) || rejection.Reason != RejectTimeout {
+		t.Errorf("expected timeout rejection, got %v", err)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec("DELETE FROM orders"); err == nil {
+		t.Fatal("expected write to fail on a read-only connection")
+	}
+}
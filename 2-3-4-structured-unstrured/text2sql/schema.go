@@ -0,0 +1,275 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Column describes a table column as reported by PRAGMA table_info.
+type Column struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+}
+
+// ForeignKey links a column to a column of another table.
+// Inferred is set for links guessed from column names rather than declared in the schema.
+type ForeignKey struct {
+	From     string
+	Table    string
+	To       string
+	Inferred bool
+}
+
+type Table struct {
+	Name        string
+	Columns     []Column
+	ForeignKeys []ForeignKey
+}
+
+// Schema is the structure of a SQLite database, used to ground the model's queries.
+type Schema struct {
+	Tables []Table
+}
+
+// IntrospectSchema reads the tables, columns and foreign keys of a SQLite database
+// from sqlite_master, PRAGMA table_info and PRAGMA foreign_key_list.
+// Databases that do not declare foreign keys get links inferred from
+// "<entity>_id" columns that match a table's primary key or name.
+func IntrospectSchema(ctx context.Context, db *sql.DB) (Schema, error) {
+	var schema Schema
+
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return schema, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return schema, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return schema, fmt.Errorf("error iterating tables: %w", err)
+	}
+
+	for _, name := range names {
+		table := Table{Name: name}
+		if table.Columns, err = tableColumns(ctx, db, name); err != nil {
+			return schema, err
+		}
+		if table.ForeignKeys, err = tableForeignKeys(ctx, db, name); err != nil {
+			return schema, err
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+
+	schema.inferForeignKeys()
+	return schema, nil
+}
+
+func tableColumns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name, type, "notnull", pk FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []Column
+	for rows.Next() {
+		var col Column
+		var pk int
+		if err := rows.Scan(&col.Name, &col.Type, &col.NotNull, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan column of %s: %w", table, err)
+		}
+		col.PrimaryKey = pk > 0
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating columns of %s: %w", table, err)
+	}
+	return columns, nil
+}
+
+func tableForeignKeys(ctx context.Context, db *sql.DB, table string) ([]ForeignKey, error) {
+	rows, err := db.QueryContext(ctx, `SELECT "seq", "from", "table", "to" FROM pragma_foreign_key_list(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var keys []ForeignKey
+	var seqs []int
+	for rows.Next() {
+		var fk ForeignKey
+		var seq int
+		var to sql.NullString
+		if err := rows.Scan(&seq, &fk.From, &fk.Table, &to); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key of %s: %w", table, err)
+		}
+		fk.To = to.String
+		keys = append(keys, fk)
+		seqs = append(seqs, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating foreign keys of %s: %w", table, err)
+	}
+	rows.Close()
+
+	// A foreign key without a target column references the parent's primary key.
+	resolved := keys[:0]
+	for i, fk := range keys {
+		if fk.To == "" {
+			pk, err := primaryKey(ctx, db, fk.Table)
+			if err != nil {
+				return nil, err
+			}
+			// SQLite rejects a key whose parent has no such primary key column.
+			if seqs[i] >= len(pk) {
+				continue
+			}
+			fk.To = pk[seqs[i]]
+		}
+		resolved = append(resolved, fk)
+	}
+	return resolved, nil
+}
+
+// primaryKey returns the primary key columns of table in key order.
+func primaryKey(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read primary key of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key of %s: %w", table, err)
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating primary key of %s: %w", table, err)
+	}
+	return columns, nil
+}
+
+// inferForeignKeys links "<entity>_id" columns to the table named after the
+// entity (e.g. orders.customer_id to customers.customer_id) when the schema
+// declares no foreign key for that column.
+func (s *Schema) inferForeignKeys() {
+	owners := map[string]string{}
+	for _, t := range s.Tables {
+		for _, col := range t.Columns {
+			if strings.HasSuffix(col.Name, "_id") && singular(t.Name)+"_id" == col.Name {
+				owners[col.Name] = t.Name
+			}
+		}
+	}
+
+	for i := range s.Tables {
+		t := &s.Tables[i]
+		declared := map[string]bool{}
+		for _, fk := range t.ForeignKeys {
+			declared[fk.From] = true
+		}
+		for _, col := range t.Columns {
+			owner, ok := owners[col.Name]
+			if !ok || owner == t.Name || declared[col.Name] {
+				continue
+			}
+			t.ForeignKeys = append(t.ForeignKeys, ForeignKey{From: col.Name, Table: owner, To: col.Name, Inferred: true})
+		}
+	}
+}
+
+func singular(name string) string {
+	return strings.TrimSuffix(name, "s")
+}
+
+// DDL renders the schema as compact CREATE TABLE statements, one per line,
+// which is the cheapest form to put in a prompt.
+func (s Schema) DDL() string {
+	var b strings.Builder
+	for _, t := range s.Tables {
+		parts := make([]string, 0, len(t.Columns)+len(t.ForeignKeys))
+		for _, col := range t.Columns {
+			def := col.Name
+			if col.Type != "" {
+				def += " " + col.Type
+			}
+			if col.PrimaryKey {
+				def += " PRIMARY KEY"
+			}
+			if col.NotNull && !col.PrimaryKey {
+				def += " NOT NULL"
+			}
+			parts = append(parts, def)
+		}
+		var inferred []string
+		for _, fk := range t.ForeignKeys {
+			if fk.Inferred {
+				inferred = append(inferred, fmt.Sprintf("%s.%s -> %s.%s", t.Name, fk.From, fk.Table, fk.To))
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s(%s)", fk.From, fk.Table, fk.To))
+		}
+		fmt.Fprintf(&b, "CREATE TABLE %s (%s);\n", t.Name, strings.Join(parts, ", "))
+		for _, link := range inferred {
+			fmt.Fprintf(&b, "-- joins on %s\n", link)
+		}
+	}
+	return b.String()
+}
+
+var mermaidTypeInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Mermaid renders the schema as a Mermaid erDiagram.
+func (s Schema) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+	for _, t := range s.Tables {
+		for _, fk := range t.ForeignKeys {
+			fmt.Fprintf(&b, "    %s ||--o{ %s : \"%s\"\n", fk.Table, t.Name, fk.From)
+		}
+	}
+	for _, t := range s.Tables {
+		fmt.Fprintf(&b, "    %s {\n", t.Name)
+		for _, col := range t.Columns {
+			typ := mermaidTypeInvalid.ReplaceAllString(col.Type, "_")
+			if typ == "" {
+				typ = "ANY"
+			}
+			fmt.Fprintf(&b, "        %s %s", typ, col.Name)
+			if col.PrimaryKey {
+				b.WriteString(" PK")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+	return b.String()
+}
+
+// Render returns the schema as "ddl" or "mermaid".
+func (s Schema) Render(format string) (string, error) {
+	switch format {
+	case "", "ddl":
+		return s.DDL(), nil
+	case "mermaid":
+		return s.Mermaid(), nil
+	default:
+		return "", fmt.Errorf("unknown schema format %q", format)
+	}
+}
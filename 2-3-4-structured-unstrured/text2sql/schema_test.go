@@ -0,0 +1,96 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIntrospectSchema(t *testing.T) {
+	schema, err := IntrospectSchema(context.Background(), newTestDB(t))
+	if err != nil {
+		t.Fatalf("Error reading schema: %v", err)
+	}
+
+	var names []string
+	for _, table := range schema.Tables {
+		names = append(names, table.Name)
+	}
+	if got := strings.Join(names, ","); got != "customers,order_items,orders,sellers" {
+		t.Errorf("Unexpected tables: %s", got)
+	}
+
+	ddl := schema.DDL()
+	for _, want := range []string{
+		"CREATE TABLE orders (order_id TEXT PRIMARY KEY, customer_id TEXT,",
+		"FOREIGN KEY (customer_id) REFERENCES customers(customer_id)",
+		"FOREIGN KEY (seller_id) REFERENCES sellers(seller_id)",
+	} {
+		if !strings.Contains(ddl, want) {
+			t.Errorf("DDL is missing %q:\n%s", want, ddl)
+		}
+	}
+
+	mermaid := schema.Mermaid()
+	for _, want := range []string{
+		"erDiagram",
+		`customers ||--o{ orders : "customer_id"`,
+		"TEXT order_id PK",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Mermaid is missing %q:\n%s", want, mermaid)
+		}
+	}
+}
+
+func TestIntrospectSchemaInfersJoins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nofk.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE products (product_id TEXT, product_category_name TEXT)`,
+		`CREATE TABLE order_items (order_id TEXT, product_id TEXT, price REAL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Error preparing database: %v", err)
+		}
+	}
+
+	schema, err := IntrospectSchema(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Error reading schema: %v", err)
+	}
+	if ddl := schema.DDL(); !strings.Contains(ddl, "-- joins on order_items.product_id -> products.product_id") {
+		t.Errorf("Expected inferred join in DDL:\n%s", ddl)
+	}
+}
+
+func TestIntrospectSchemaImplicitForeignKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "implicit.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE customers (id TEXT PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE orders (order_id TEXT PRIMARY KEY, customer_id TEXT REFERENCES customers)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Error preparing database: %v", err)
+		}
+	}
+
+	schema, err := IntrospectSchema(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Error reading schema: %v", err)
+	}
+	if ddl := schema.DDL(); !strings.Contains(ddl, "FOREIGN KEY (customer_id) REFERENCES customers(id)") {
+		t.Errorf("Expected the foreign key to reference the primary key:\n%s", ddl)
+	}
+}
@@ -0,0 +1,337 @@
+// Package text2sql answers natural language questions about a SQLite database
+// by asking a model for a SQL query and running it in a read-only sandbox.
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	structuredoutput "llmdojo"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/openai/openai-go"
+)
+
+type Step struct {
+	Explanation string `json:"explanation"`
+	// Output      string `json:"output"`
+}
+type AgentResponseFormat struct {
+	Steps       []Step `json:"steps"`
+	FinalOutput string `json:"finalOutput"`
+	// AnswerType and AnswerColumn echo the question's "[type: column]" hint.
+	AnswerType   string `json:"answerType" jsonschema:"enum=string,enum=integer,enum=float,enum=boolean,enum=string[],enum=integer[],enum=float[],enum=boolean[]"`
+	AnswerColumn string `json:"answerColumn"`
+}
+
+var sqlPipelineFormat = structuredoutput.GenerateOptions{
+	Name:        "SqlPipeline",
+	Description: "SQL pipeline for generating SQL queries",
+	MaxRetries:  2,
+}
+
+// Validate rejects answers without reasoning steps or without a query.
+func (a AgentResponseFormat) Validate() error {
+	if len(a.Steps) == 0 {
+		return fmt.Errorf("steps must explain the reasoning in at least one step")
+	}
+	if strings.TrimSpace(a.FinalOutput) == "" {
+		return fmt.Errorf("finalOutput must contain the SQL query")
+	}
+	if a.AnswerType != "" {
+		if _, err := ParseAnswerType(a.AnswerType); err != nil {
+			return fmt.Errorf("answerType: %w", err)
+		}
+	}
+	return nil
+}
+
+// expectedType returns the answer type for question: its own type hint, or
+// else the type the model declared in its response.
+func (a AgentResponseFormat) expectedType(question string) (TypeHint, bool) {
+	if hint, ok := ParseTypeHint(question); ok {
+		return hint, true
+	}
+	if a.AnswerType == "" {
+		return TypeHint{}, false
+	}
+	hint, err := ParseAnswerType(a.AnswerType)
+	if err != nil {
+		return TypeHint{}, false
+	}
+	hint.Column = a.AnswerColumn
+	return hint, true
+}
+
+//go:embed prompts
+var promptFiles embed.FS
+
+// SystemPromptName is the name of the SQL system prompt in an Agent's Prompts.
+const SystemPromptName = "sql-system"
+
+// PromptData are the variables of the SQL system prompt.
+type PromptData struct {
+	// Schema is the rendered database schema, or how to look it up with SchemaTools.
+	Schema string
+	// Examples are the few-shot examples for the question. They are sent as
+	// messages after the system prompt as well.
+	Examples []Example
+}
+
+// DefaultPrompts returns a registry with the prompts under prompts/, one
+// directory per prompt with a template file per version.
+func DefaultPrompts() *structuredoutput.PromptRegistry {
+	prompts := structuredoutput.NewPromptRegistry()
+	dir, err := fs.Sub(promptFiles, "prompts")
+	if err == nil {
+		err = prompts.Load(dir)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("text2sql: embedded prompts: %v", err))
+	}
+	return prompts
+}
+
+var defaultPrompts = DefaultPrompts()
+
+// SystemPrompt embeds the rendered database schema into the latest SQL system prompt.
+func SystemPrompt(schema string) (string, error) {
+	text, _, err := defaultPrompts.Render(SystemPromptName, PromptData{Schema: schema})
+	return text, err
+}
+
+// Example is a verified question/SQL pair shown to the model as a few-shot example.
+type Example struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// DefaultExamples are the few-shot examples used for the Olist dataset.
+var DefaultExamples = []Example{
+	{
+		Question: "Which seller has delivered the most orders to customers in Rio de Janeiro? [string: seller_id]",
+		Answer:   "SELECT oi.seller_id, COUNT(DISTINCT o.order_id) AS order_count FROM orders o JOIN customers c ON o.customer_id = c.customer_id JOIN order_items oi ON o.order_id = oi.order_id WHERE c.customer_city = 'rio de janeiro' AND o.order_status = 'delivered' GROUP BY oi.seller_id ORDER BY order_count DESC LIMIT 1;",
+	},
+	{
+		Question: "What's the average review score for 'beleza_saude' products?",
+		Answer:   "SELECT AVG(r.review_score) AS avg_score FROM order_reviews r JOIN order_items oi ON r.order_id = oi.order_id JOIN products p ON oi.product_id = p.product_id WHERE p.product_category_name = 'beleza_saude';",
+	},
+}
+
+// DefaultTimeout leaves room for the model to reason over the schema before answering.
+const DefaultTimeout = 60 * time.Second
+
+// DefaultMaxExamples is how many examples a Selector picks per question.
+const DefaultMaxExamples = 3
+
+// DefaultRepairRounds bounds how often a failing query is sent back to the model.
+const DefaultRepairRounds = 3
+
+// Answer is the outcome of a question: the model's final answer, the rows
+// it produced and every repair round it took to get there. Typed holds the
+// rows coerced to the question's answer type, if it has one.
+type Answer struct {
+	Question string              `json:"question"`
+	Response AgentResponseFormat `json:"response"`
+	ResultSet
+	Typed   *TypedAnswer    `json:"typed,omitempty"`
+	Repairs []RepairAttempt `json:"repairs"`
+	// Prompt is the system prompt version the question was asked with, e.g. "sql-system@v1".
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// Agent turns questions into SQL. The zero value is not usable; use NewAgent.
+type Agent struct {
+	Examples []Example
+	// Selector, when set, picks MaxExamples examples per question instead of
+	// showing all Examples, e.g. NewBM25Selector over a large example store.
+	Selector    ExampleSelector
+	MaxExamples int
+	Repair      RepairOptions
+	Limits      QueryLimits
+	// SchemaFormat is "ddl", "mermaid" or SchemaTools.
+	SchemaFormat string
+	// Prompts hold the system prompt (SystemPromptName); choose its version with Prompts.Use.
+	Prompts *structuredoutput.PromptRegistry
+	// ChatOptions configure every conversation, e.g. provider, model or timeout.
+	ChatOptions []structuredoutput.Option
+	// OnStream, when set, streams the model's answers to it piece by piece,
+	// e.g. to show the explanation of each step as it arrives.
+	OnStream func(structuredoutput.StreamEvent)
+}
+
+// NewAgent returns an Agent with the default examples, repair rounds and query limits.
+func NewAgent(chatOpts ...structuredoutput.Option) *Agent {
+	return &Agent{
+		Examples:     DefaultExamples,
+		MaxExamples:  DefaultMaxExamples,
+		Repair:       RepairOptions{MaxRounds: DefaultRepairRounds, ExplainPlan: true},
+		Limits:       DefaultQueryLimits,
+		SchemaFormat: "ddl",
+		Prompts:      DefaultPrompts(),
+		ChatOptions:  append([]structuredoutput.Option{structuredoutput.WithTimeout(DefaultTimeout)}, chatOpts...),
+	}
+}
+
+// Ask answers question against db with a default Agent.
+func Ask(ctx context.Context, db *sql.DB, question string) (Answer, error) {
+	return NewAgent().Ask(ctx, db, question)
+}
+
+// Ask introspects db, asks the model for a query answering question and runs it.
+// When SQLite rejects the query, or its result does not fit the answer type
+// (see Coerce), the error is fed back to the model, which is asked to repair
+// its finalOutput, for up to a.Repair.MaxRounds rounds. The answer carries
+// the repair trail even when the question could not be answered.
+func (a *Agent) Ask(ctx context.Context, db *sql.DB, question string) (Answer, error) {
+	answer := Answer{Question: question}
+
+	prompt, version, err := a.systemPrompt(ctx, db, question)
+	if err != nil {
+		return answer, err
+	}
+	answer.Prompt = version.String()
+
+	conv := a.NewConversation(0, prompt, question)
+	a.useTools(conv, db)
+	return a.answer(ctx, conv, db, answer)
+}
+
+// Continue asks question as a follow-up in conv, e.g. a session resumed from a
+// structuredoutput.MemoryStore, so the model sees the earlier questions and
+// queries. An empty conversation is primed like in Ask.
+func (a *Agent) Continue(ctx context.Context, conv *structuredoutput.ChatContext, db *sql.DB, question string) (Answer, error) {
+	answer := Answer{Question: question}
+	a.useTools(conv, db)
+	if len(conv.Snapshot().Messages) > 0 {
+		// The session keeps the system prompt it was primed with; record the current version.
+		if version, err := a.prompts().Get(SystemPromptName); err == nil {
+			answer.Prompt = version.String()
+		}
+		conv.AddMessage(openai.UserMessage(question))
+		return a.answer(ctx, conv, db, answer)
+	}
+
+	prompt, version, err := a.systemPrompt(ctx, db, question)
+	if err != nil {
+		return answer, err
+	}
+	answer.Prompt = version.String()
+	conv.SetMemory(a.NewConversation(conv.Id, prompt, question).Memory)
+	return a.answer(ctx, conv, db, answer)
+}
+
+// useTools offers the SQLTools to conv when the agent explores the schema with tools.
+// Tool queries are held to fewer rows than answers to keep the conversation small.
+func (a *Agent) useTools(conv *structuredoutput.ChatContext, db *sql.DB) {
+	if a.SchemaFormat != SchemaTools {
+		return
+	}
+	conv.SetTools(SQLTools(db, QueryLimits{MaxRows: maxToolRows, Timeout: a.Limits.Timeout}))
+}
+
+// toolsSchema stands in for the schema in the prompt with SchemaTools.
+const toolsSchema = `Not included. Use list_tables and describe_table to look it up,
+sample_rows and distinct_values to check how values are stored (for example the letter case of names),
+and run_query to try your query before giving the finalOutput.`
+
+// systemPrompt introspects db and renders the system prompt for it and
+// question. It returns the prompt version it used.
+func (a *Agent) systemPrompt(ctx context.Context, db *sql.DB, question string) (string, *structuredoutput.Prompt, error) {
+	data := PromptData{Schema: toolsSchema, Examples: a.examples(question)}
+	if a.SchemaFormat != SchemaTools {
+		schema, err := IntrospectSchema(ctx, db)
+		if err != nil {
+			return "", nil, err
+		}
+		if data.Schema, err = schema.Render(a.SchemaFormat); err != nil {
+			return "", nil, err
+		}
+	}
+	return a.prompts().Render(SystemPromptName, data)
+}
+
+func (a *Agent) prompts() *structuredoutput.PromptRegistry {
+	if a.Prompts != nil {
+		return a.Prompts
+	}
+	return defaultPrompts
+}
+
+// NewConversation primes a conversation with the system prompt (see SystemPrompt),
+// the few-shot examples for the question and the question itself.
+func (a *Agent) NewConversation(id int, systemPrompt string, question string) *structuredoutput.ChatContext {
+	conv := structuredoutput.NewChatContext(id, a.ChatOptions...)
+
+	// Add system message to the conversation
+	// This message is used to set the context for the conversation
+	// Explains the role of the assistant, and introduces to the database schema
+	// and the task at hand
+	conv.AddMessage(openai.ChatCompletionMessageParamUnion{
+		OfSystem: &openai.ChatCompletionSystemMessageParam{
+			Content: openai.ChatCompletionSystemMessageParamContentUnion{
+				OfString: openai.String(systemPrompt),
+			},
+		},
+	})
+
+	// few-short learning
+	for _, example := range a.examples(question) {
+		conv.AddMessage(openai.ChatCompletionMessageParamUnion{
+			OfUser: &openai.ChatCompletionUserMessageParam{
+				Content: openai.ChatCompletionUserMessageParamContentUnion{
+					OfString: openai.String(example.Question),
+				},
+			},
+		})
+		conv.AddMessage(openai.ChatCompletionMessageParamUnion{
+			OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+				Content: openai.ChatCompletionAssistantMessageParamContentUnion{
+					OfString: openai.String(example.Answer),
+				},
+			},
+		})
+	}
+
+	// The system prompt and examples survive memory trimming in long sessions.
+	conv.Memory.Pin()
+
+	// user question
+	conv.AddMessage(openai.ChatCompletionMessageParamUnion{
+		OfUser: &openai.ChatCompletionUserMessageParam{
+			Content: openai.ChatCompletionUserMessageParamContentUnion{
+				OfString: openai.String(question),
+			},
+		},
+	})
+	return conv
+}
+
+// examples returns the few-shot examples for question.
+func (a *Agent) examples(question string) []Example {
+	if a.Selector == nil {
+		return a.Examples
+	}
+	return a.Selector.Select(question, a.MaxExamples)
+}
+
+// GenerateSQL asks the model to answer the conversation's last question with a SQL query.
+func GenerateSQL(ctx context.Context, conv *structuredoutput.ChatContext) (AgentResponseFormat, error) {
+	return structuredoutput.Generate[AgentResponseFormat](ctx, conv, sqlPipelineFormat)
+}
+
+// generateSQL is GenerateSQL, streamed to a.OnStream when it is set.
+func (a *Agent) generateSQL(ctx context.Context, conv *structuredoutput.ChatContext) (AgentResponseFormat, error) {
+	if a.OnStream == nil {
+		return GenerateSQL(ctx, conv)
+	}
+	stream := structuredoutput.GenerateStream[AgentResponseFormat](ctx, conv, sqlPipelineFormat)
+	for event := range stream.Events() {
+		a.OnStream(event)
+	}
+	return stream.Wait()
+}
@@ -0,0 +1,268 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	structuredoutput "llmdojo"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+// newTestDBPath creates a small SQLite database shaped like the Olist dataset.
+func newTestDBPath(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "olist.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Error opening test database: %v", err)
+	}
+	defer db.Close()
+
+	stmts := []string{
+		`CREATE TABLE customers (customer_id TEXT PRIMARY KEY, customer_unique_id TEXT, customer_zip_code_prefix TEXT, customer_city TEXT, customer_state TEXT)`,
+		`CREATE TABLE sellers (seller_id TEXT PRIMARY KEY, seller_zip_code_prefix TEXT, seller_city TEXT, seller_state TEXT)`,
+		`CREATE TABLE orders (order_id TEXT PRIMARY KEY, customer_id TEXT REFERENCES customers(customer_id), order_status TEXT, order_purchase_timestamp TEXT, order_delivered_customer_date TEXT, order_estimated_delivery_date TEXT)`,
+		`CREATE TABLE order_items (order_id TEXT REFERENCES orders(order_id), order_item_id INTEGER, product_id TEXT, seller_id TEXT REFERENCES sellers(seller_id), price REAL, freight_value REAL)`,
+		`INSERT INTO customers VALUES ('c1', 'u1', '20000', 'rio de janeiro', 'RJ'), ('c2', 'u2', '01000', 'sao paulo', 'SP')`,
+		`INSERT INTO sellers VALUES ('s1', '20000', 'rio de janeiro', 'RJ'), ('s2', '01000', 'sao paulo', 'SP')`,
+		`INSERT INTO orders VALUES ('o1', 'c1', 'delivered', '2018-01-01', '2018-01-05', '2018-01-10'), ('o2', 'c1', 'delivered', '2018-02-01', '2018-02-15', '2018-02-10'), ('o3', 'c2', 'shipped', '2018-03-01', NULL, '2018-03-10')`,
+		`INSERT INTO order_items VALUES ('o1', 1, 'p1', 's1', 10.5, 2.0), ('o2', 1, 'p2', 's1', 20.0, 3.5), ('o3', 1, 'p1', 's2', 10.5, 1.0)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Error preparing test database: %v", err)
+		}
+	}
+	return path
+}
+
+// newTestDB opens the test database read-only, as the CLI does.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(newTestDBPath(t))
+	if err != nil {
+		t.Fatalf("Error opening test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestAgent returns an Agent whose conversations are served by p.
+func newTestAgent(p structuredoutput.Provider) *Agent {
+	return NewAgent(structuredoutput.WithProvider(p))
+}
+
+const sellerQuestion = "Which seller has delivered the most orders to customers in Rio de Janeiro? [string: seller_id]"
+
+const sellerAnswer = `{"steps":[{"explanation":"Join orders, customers and order_items."},{"explanation":"Count delivered orders per seller in rio de janeiro."}],"finalOutput":"SELECT oi.seller_id, COUNT(DISTINCT o.order_id) AS order_count FROM orders o JOIN customers c ON o.customer_id = c.customer_id JOIN order_items oi ON o.order_id = oi.order_id WHERE c.customer_city = 'rio de janeiro' AND o.order_status = 'delivered' GROUP BY oi.seller_id ORDER BY order_count DESC LIMIT 1;"}`
+
+func TestAsk(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+
+	answer, err := newTestAgent(fake).Ask(context.Background(), db, sellerQuestion)
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	if len(answer.Response.Steps) != 2 {
+		t.Errorf("Expected 2 steps, got: %d", len(answer.Response.Steps))
+	}
+	if len(answer.Columns) != 2 || answer.Columns[0] != "seller_id" || answer.Columns[1] != "order_count" {
+		t.Errorf("Unexpected columns: %v", answer.Columns)
+	}
+	if len(answer.Rows) != 1 {
+		t.Fatalf("Expected 1 row, got: %d", len(answer.Rows))
+	}
+	if got := answer.Rows[0]["seller_id"]; got != "s1" {
+		t.Errorf("Expected seller_id: s1, got: %v", got)
+	}
+	if got := answer.Rows[0]["order_count"]; got != int64(2) {
+		t.Errorf("Expected order_count: 2, got: %v", got)
+	}
+	if answer.Typed == nil || answer.Typed.Value != "s1" || answer.Typed.Column != "seller_id" {
+		t.Errorf("Unexpected typed answer: %+v", answer.Typed)
+	}
+
+	// system prompt + few-shot pairs + question
+	if got := len(fake.Calls()[0].Messages); got != 2+2*len(DefaultExamples) {
+		t.Errorf("Unexpected prompt length: %d", got)
+	}
+}
+
+func TestAskPromptVersion(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+	agent := newTestAgent(fake)
+
+	answer, err := agent.Ask(context.Background(), db, sellerQuestion)
+	if err != nil || answer.Prompt != "sql-system@v1" {
+		t.Errorf("Expected prompt: sql-system@v1, got: %q (%v)", answer.Prompt, err)
+	}
+	got := fake.Calls()[0].Messages[0].OfSystem.Content.OfString.Value
+	if want, err := SystemPrompt(got[strings.Index(got, "CREATE TABLE"):]); err != nil || got != want {
+		t.Errorf("Expected the v1 prompt with the schema, got: %s (%v)", got, err)
+	}
+
+	v2 := "Write SQLite for this schema:\n{{.Schema}}\nLike in:{{range .Examples}}\n{{.Question}}{{end}}"
+	if err := agent.Prompts.Add(SystemPromptName, "v2", v2); err != nil {
+		t.Fatal(err)
+	}
+	answer, err = agent.Ask(context.Background(), db, sellerQuestion)
+	if err != nil || answer.Prompt != "sql-system@v2" {
+		t.Errorf("Expected prompt: sql-system@v2, got: %q (%v)", answer.Prompt, err)
+	}
+	system := fake.Calls()[1].Messages[0].OfSystem.Content.OfString.Value
+	if !strings.HasPrefix(system, "Write SQLite") || !strings.Contains(system, DefaultExamples[1].Question) {
+		t.Errorf("Expected the v2 prompt with the examples, got: %s", system)
+	}
+
+	if err := agent.Prompts.Use(SystemPromptName, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if answer, _ := agent.Ask(context.Background(), db, sellerQuestion); answer.Prompt != "sql-system@v1" {
+		t.Errorf("Expected the selected prompt: sql-system@v1, got: %q", answer.Prompt)
+	}
+}
+
+func TestAskStream(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+	agent := newTestAgent(fake)
+	var fields []string
+	agent.OnStream = func(event structuredoutput.StreamEvent) {
+		for _, field := range event.Fields {
+			if strings.HasSuffix(field.Path, "explanation") || field.Path == "finalOutput" {
+				fields = append(fields, field.Text())
+			}
+		}
+	}
+
+	answer, err := agent.Ask(context.Background(), db, sellerQuestion)
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	want := []string{answer.Response.Steps[0].Explanation, answer.Response.Steps[1].Explanation, answer.Response.FinalOutput}
+	if strings.Join(fields, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected streamed fields: %v, got: %v", want, fields)
+	}
+}
+
+func TestAskInvalidResponse(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", `not json`)
+
+	_, err := newTestAgent(fake).Ask(context.Background(), db, sellerQuestion)
+	var mismatch *structuredoutput.SchemaMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected schema mismatch for malformed agent response, got: %v", err)
+	}
+}
+
+func TestAskModelAnswerType(t *testing.T) {
+	db := newTestDB(t)
+	resp := `{"steps":[{"explanation":"Count sellers."}],"finalOutput":"SELECT COUNT(*) AS n FROM sellers","answerType":"integer","answerColumn":"n"}`
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", resp)
+
+	answer, err := newTestAgent(fake).Ask(context.Background(), db, "How many sellers are there?")
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	if answer.Typed == nil || answer.Typed.Value != int64(2) {
+		t.Errorf("Expected typed answer 2, got: %+v", answer.Typed)
+	}
+}
+
+func TestContinueResumedSession(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	store := structuredoutput.NewJSONLStore(filepath.Join(t.TempDir(), "session.jsonl"))
+	fake := structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer)
+	agent := newTestAgent(fake)
+
+	conv := structuredoutput.NewChatContext(1, agent.ChatOptions...)
+	if _, err := agent.Continue(ctx, conv, db, sellerQuestion); err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	if err := conv.Save(ctx, store); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	resumed, err := structuredoutput.ResumeChatContext(ctx, store, 1, agent.ChatOptions...)
+	if err != nil {
+		t.Fatalf("Error resuming session: %v", err)
+	}
+	if _, err := agent.Continue(ctx, resumed, db, "And which one in Sao Paulo? [string: seller_id]"); err != nil {
+		t.Fatalf("Error answering follow-up: %v", err)
+	}
+
+	first, second := fake.Calls()[0].Messages, fake.Calls()[1].Messages
+	// The follow-up carries the first exchange plus the new question.
+	if len(second) != len(first)+2 {
+		t.Errorf("Expected %d messages in the follow-up, got: %d", len(first)+2, len(second))
+	}
+	if got := second[len(second)-1].OfUser.Content.OfString.Value; got != "And which one in Sao Paulo? [string: seller_id]" {
+		t.Errorf("Unexpected last message: %q", got)
+	}
+}
+
+// TestContinueConcurrentUse is meant for the race detector: the conversation
+// is forked and extended while Continue primes it and offers it tools.
+func TestContinueConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	agent := newTestAgent(structuredoutput.NewFakeProvider().OnSchema("SqlPipeline", sellerAnswer))
+	agent.SchemaFormat = SchemaTools
+	conv := structuredoutput.NewChatContext(1, agent.ChatOptions...)
+
+	started, done := make(chan struct{}, 4), make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conv.Fork()
+			started <- struct{}{}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					conv.Fork().AddMessage(openai.UserMessage("side question"))
+				}
+			}
+		}()
+	}
+	for range 4 {
+		<-started
+	}
+	_, err := agent.Continue(ctx, conv, db, sellerQuestion)
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+}
+
+func TestResponseSchemaAnswerType(t *testing.T) {
+	schema := structuredoutput.ResponseSchema[AgentResponseFormat]("SqlPipeline", "")
+	data, err := json.Marshal(schema.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"enum":["string","integer","float","boolean","string[]","integer[]","float[]","boolean[]"]`) {
+		t.Errorf("Expected answerType enum in schema: %s", data)
+	}
+}
+
+func TestExecuteSQLQueryError(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := ExecuteSQLQuery(context.Background(), db, "SELECT o.seller_id FROM orders o", DefaultQueryLimits); err == nil {
+		t.Fatal("Expected error for unknown column")
+	}
+}
@@ -0,0 +1,158 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	structuredoutput "llmdojo"
+	"strings"
+)
+
+// SchemaTools is the Agent.SchemaFormat that leaves the schema out of the
+// prompt and lets the model explore the database with SQLTools instead.
+const SchemaTools = "tools"
+
+// maxToolRows caps the rows sample_rows and distinct_values return.
+const maxToolRows = 50
+
+type tableArgs struct {
+	Table string `json:"table" jsonschema_description:"Name of the table"`
+}
+
+type sampleRowsArgs struct {
+	Table string `json:"table" jsonschema_description:"Name of the table"`
+	Limit int    `json:"limit" jsonschema_description:"Number of rows, at most 50"`
+}
+
+type distinctValuesArgs struct {
+	Table  string `json:"table" jsonschema_description:"Name of the table"`
+	Column string `json:"column" jsonschema_description:"Name of the column"`
+	Limit  int    `json:"limit" jsonschema_description:"Number of values, at most 50"`
+}
+
+type runQueryArgs struct {
+	Query string `json:"query" jsonschema_description:"A single read-only SELECT statement"`
+}
+
+// toolResult is a compact form of a ResultSet for tool messages.
+type toolResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+func newToolResult(result ResultSet) toolResult {
+	out := toolResult{Columns: result.Columns, Rows: make([][]interface{}, len(result.Rows))}
+	for i, row := range result.Rows {
+		values := make([]interface{}, len(result.Columns))
+		for j, col := range result.Columns {
+			values[j] = row[col]
+			if b, ok := values[j].([]byte); ok {
+				values[j] = string(b)
+			}
+		}
+		out.Rows[i] = values
+	}
+	return out
+}
+
+// SQLTools returns tools for exploring db: list_tables, describe_table,
+// sample_rows, distinct_values and run_query. Every query goes through
+// ExecuteSQLQuery with limits, and table and column names are checked
+// against the schema before they are put into a query.
+func SQLTools(db *sql.DB, limits QueryLimits) *structuredoutput.ToolRegistry {
+	tools := structuredoutput.NewToolRegistry()
+
+	structuredoutput.RegisterTool(tools, "list_tables", "Lists the tables of the database.",
+		func(ctx context.Context, _ struct{}) ([]string, error) {
+			schema, err := IntrospectSchema(ctx, db)
+			if err != nil {
+				return nil, err
+			}
+			names := make([]string, len(schema.Tables))
+			for i, t := range schema.Tables {
+				names[i] = t.Name
+			}
+			return names, nil
+		})
+
+	structuredoutput.RegisterTool(tools, "describe_table", "Shows the columns, types and foreign keys of a table as CREATE TABLE.",
+		func(ctx context.Context, args tableArgs) (string, error) {
+			table, err := lookupTable(ctx, db, args.Table)
+			if err != nil {
+				return "", err
+			}
+			return Schema{Tables: []Table{table}}.DDL(), nil
+		})
+
+	structuredoutput.RegisterTool(tools, "sample_rows", "Returns the first rows of a table to show how values are stored.",
+		func(ctx context.Context, args sampleRowsArgs) (toolResult, error) {
+			table, err := lookupTable(ctx, db, args.Table)
+			if err != nil {
+				return toolResult{}, err
+			}
+			query := fmt.Sprintf("SELECT * FROM %s LIMIT %d", quoteIdent(table.Name), clampRows(args.Limit))
+			result, err := ExecuteSQLQuery(ctx, db, query, limits)
+			return newToolResult(result), err
+		})
+
+	structuredoutput.RegisterTool(tools, "distinct_values", "Returns the most frequent values of a column with their counts, e.g. to check spelling and letter case.",
+		func(ctx context.Context, args distinctValuesArgs) (toolResult, error) {
+			table, err := lookupTable(ctx, db, args.Table)
+			if err != nil {
+				return toolResult{}, err
+			}
+			column, err := lookupColumn(table, args.Column)
+			if err != nil {
+				return toolResult{}, err
+			}
+			query := fmt.Sprintf("SELECT %[1]s, COUNT(*) AS count FROM %[2]s GROUP BY %[1]s ORDER BY count DESC LIMIT %[3]d",
+				quoteIdent(column), quoteIdent(table.Name), clampRows(args.Limit))
+			result, err := ExecuteSQLQuery(ctx, db, query, limits)
+			return newToolResult(result), err
+		})
+
+	structuredoutput.RegisterTool(tools, "run_query", "Runs a read-only SQL query and returns its rows, to try a query before answering.",
+		func(ctx context.Context, args runQueryArgs) (toolResult, error) {
+			result, err := ExecuteSQLQuery(ctx, db, args.Query, limits)
+			return newToolResult(result), err
+		})
+
+	return tools
+}
+
+func lookupTable(ctx context.Context, db *sql.DB, name string) (Table, error) {
+	schema, err := IntrospectSchema(ctx, db)
+	if err != nil {
+		return Table{}, err
+	}
+	names := make([]string, len(schema.Tables))
+	for i, t := range schema.Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t, nil
+		}
+		names[i] = t.Name
+	}
+	return Table{}, fmt.Errorf("unknown table %q; tables are %s", name, strings.Join(names, ", "))
+}
+
+func lookupColumn(table Table, name string) (string, error) {
+	names := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return col.Name, nil
+		}
+		names[i] = col.Name
+	}
+	return "", fmt.Errorf("unknown column %q in %s; columns are %s", name, table.Name, strings.Join(names, ", "))
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func clampRows(n int) int {
+	if n <= 0 || n > maxToolRows {
+		return maxToolRows
+	}
+	return n
+}
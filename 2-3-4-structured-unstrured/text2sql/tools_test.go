@@ -0,0 +1,82 @@
+package text2sql
+
+import (
+	"context"
+	structuredoutput "llmdojo"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func callTool(t *testing.T, tools *structuredoutput.ToolRegistry, name string, args string) string {
+	t.Helper()
+	call := openai.ChatCompletionMessageToolCall{ID: "call_1", Function: openai.ChatCompletionMessageToolCallFunction{Name: name, Arguments: args}}
+	return tools.Call(context.Background(), call)
+}
+
+func TestSQLTools(t *testing.T) {
+	tools := SQLTools(newTestDB(t), DefaultQueryLimits)
+
+	want := []string{"describe_table", "distinct_values", "list_tables", "run_query", "sample_rows"}
+	if got := tools.Names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected tools: %v, got: %v", want, got)
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"list_tables", `{}`, `["customers","order_items","orders","sellers"]`},
+		{"describe_table", `{"table":"Sellers"}`, `CREATE TABLE sellers`},
+		{"describe_table", `{"table":"products"}`, `unknown table \"products\"; tables are customers, order_items, orders, sellers`},
+		{"sample_rows", `{"table":"sellers","limit":1}`, `{"columns":["seller_id","seller_zip_code_prefix","seller_city","seller_state"],"rows":[["s1","20000","rio de janeiro","RJ"]]}`},
+		{"distinct_values", `{"table":"orders","column":"order_status","limit":0}`, `{"columns":["order_status","count"],"rows":[["delivered",2],["shipped",1]]}`},
+		{"distinct_values", `{"table":"orders","column":"city","limit":0}`, `unknown column \"city\" in orders`},
+		{"distinct_values", `{"table":"orders\"; DROP TABLE orders; --","column":"order_id","limit":0}`, `unknown table`},
+		{"run_query", `{"query":"SELECT COUNT(*) AS n FROM sellers WHERE seller_city = 'rio de janeiro'"}`, `{"columns":["n"],"rows":[[1]]}`},
+		{"run_query", `{"query":"DELETE FROM sellers"}`, `{"error":`},
+	}
+	for _, tt := range tests {
+		if got := callTool(t, tools, tt.name, tt.args); !strings.Contains(got, tt.want) {
+			t.Errorf("%s(%s): expected %s, got: %s", tt.name, tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestAskWithTools(t *testing.T) {
+	db := newTestDB(t)
+	fake := structuredoutput.NewFakeProvider().On("SqlPipeline", "",
+		structuredoutput.FakeResponse{ToolCalls: []structuredoutput.FakeToolCall{
+			{ID: "call_1", Name: "distinct_values", Arguments: `{"table":"customers","column":"customer_city","limit":10}`},
+		}},
+		structuredoutput.FakeResponse{Content: sellerAnswer},
+	)
+	agent := newTestAgent(fake)
+	agent.SchemaFormat = SchemaTools
+
+	answer, err := agent.Ask(context.Background(), db, sellerQuestion)
+	if err != nil {
+		t.Fatalf("Error answering question: %v", err)
+	}
+	if answer.Typed == nil || answer.Typed.Value != "s1" {
+		t.Errorf("Expected typed answer s1, got: %+v", answer.Typed)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 model calls, got: %d", len(calls))
+	}
+	if len(calls[0].Tools) != 5 {
+		t.Errorf("Expected the SQL tools in the request, got: %d", len(calls[0].Tools))
+	}
+	if prompt := calls[0].Messages[0].OfSystem.Content.OfString.Value; strings.Contains(prompt, "CREATE TABLE") {
+		t.Errorf("Expected no schema in the prompt with tools, got: %s", prompt)
+	}
+	sent := calls[1].Messages
+	result := sent[len(sent)-1].OfTool.Content.OfString.Value
+	if !strings.Contains(result, `"rio de janeiro"`) {
+		t.Errorf("Expected the stored city names in the tool result, got: %s", result)
+	}
+}
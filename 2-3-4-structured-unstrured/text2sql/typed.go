@@ -0,0 +1,198 @@
+package text2sql
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Answer types a question can ask for. A "[]" suffix, e.g. "string[]",
+// asks for a list with one value per row.
+const (
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeFloat   = "float"
+	TypeBoolean = "boolean"
+)
+
+// typeAliases maps the spellings accepted in hints onto the answer types.
+var typeAliases = map[string]string{
+	"string": TypeString, "text": TypeString,
+	"integer": TypeInteger, "int": TypeInteger,
+	"float": TypeFloat, "number": TypeFloat, "decimal": TypeFloat,
+	"boolean": TypeBoolean, "bool": TypeBoolean,
+}
+
+// TypeHint is the "[type: column]" suffix of a question, e.g. "[integer: count]".
+type TypeHint struct {
+	Type   string `json:"type"`
+	Column string `json:"column"`
+	List   bool   `json:"list,omitempty"`
+}
+
+func (h TypeHint) String() string {
+	if h.List {
+		return h.Type + "[]"
+	}
+	return h.Type
+}
+
+var typeHintPattern = regexp.MustCompile(`\[\s*([A-Za-z]+(?:\[\])?)\s*:\s*([^\]]+?)\s*\]\s*$`)
+
+// ParseTypeHint extracts the trailing type hint of a question.
+func ParseTypeHint(question string) (TypeHint, bool) {
+	m := typeHintPattern.FindStringSubmatch(question)
+	if m == nil {
+		return TypeHint{}, false
+	}
+	hint, err := ParseAnswerType(m[1])
+	if err != nil {
+		return TypeHint{}, false
+	}
+	hint.Column = m[2]
+	return hint, true
+}
+
+// ParseAnswerType parses a type such as "float" or "string[]".
+func ParseAnswerType(s string) (TypeHint, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	list := strings.HasSuffix(s, "[]")
+	t, ok := typeAliases[strings.TrimSuffix(s, "[]")]
+	if !ok {
+		return TypeHint{}, fmt.Errorf("unknown answer type %q", s)
+	}
+	return TypeHint{Type: t, List: list}, nil
+}
+
+// TypedAnswer is a query result coerced to the type the question asks for.
+// Value is a string, int64, float64 or bool, or a slice of them for lists.
+type TypedAnswer struct {
+	Type   string      `json:"type"`
+	Column string      `json:"column"`
+	Value  interface{} `json:"value"`
+}
+
+// AnswerTypeError reports a result that does not have the expected shape or type.
+type AnswerTypeError struct {
+	Hint   TypeHint
+	Column string
+	Detail string
+}
+
+func (e *AnswerTypeError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("result is not a %s: %s", e.Hint, e.Detail)
+	}
+	return fmt.Sprintf("result is not a %s in column %s: %s", e.Hint, e.Column, e.Detail)
+}
+
+// Coerce converts a result set into the answer hint asks for. The value is
+// read from the hinted column, or from the first column when the result has
+// no column of that name. Scalar types need exactly one row; list types take
+// every row. SQLite is dynamically typed, so numeric text is accepted for
+// numbers and 0/1 for booleans.
+func Coerce(result ResultSet, hint TypeHint) (TypedAnswer, error) {
+	col := hintColumn(result, hint.Column)
+	if col == "" {
+		return TypedAnswer{}, &AnswerTypeError{Hint: hint, Detail: "the result has no columns"}
+	}
+	typed := TypedAnswer{Type: hint.String(), Column: col}
+
+	if !hint.List {
+		if len(result.Rows) != 1 {
+			return typed, &AnswerTypeError{Hint: hint, Column: col, Detail: fmt.Sprintf("expected exactly one row, got %d", len(result.Rows))}
+		}
+		v, err := coerceValue(result.Rows[0][col], hint.Type)
+		if err != nil {
+			return typed, &AnswerTypeError{Hint: hint, Column: col, Detail: err.Error()}
+		}
+		typed.Value = v
+		return typed, nil
+	}
+
+	values := make([]interface{}, len(result.Rows))
+	for i, row := range result.Rows {
+		v, err := coerceValue(row[col], hint.Type)
+		if err != nil {
+			return typed, &AnswerTypeError{Hint: hint, Column: col, Detail: fmt.Sprintf("row %d: %v", i+1, err)}
+		}
+		values[i] = v
+	}
+	typed.Value = values
+	return typed, nil
+}
+
+// hintColumn returns the column named by the hint, or the first column.
+func hintColumn(result ResultSet, name string) string {
+	for _, col := range result.Columns {
+		if strings.EqualFold(col, name) {
+			return col
+		}
+	}
+	if len(result.Columns) > 0 {
+		return result.Columns[0]
+	}
+	return ""
+}
+
+func coerceValue(v interface{}, t string) (interface{}, error) {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("value is NULL")
+	}
+
+	switch t {
+	case TypeString:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		}
+	case TypeInteger:
+		switch v := v.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case TypeFloat:
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+	case TypeBoolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown answer type %q", t)
+	}
+	return nil, fmt.Errorf("cannot use %v (%T) as %s", v, v, t)
+}
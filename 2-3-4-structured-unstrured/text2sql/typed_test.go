@@ -0,0 +1,84 @@
+package text2sql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseTypeHint(t *testing.T) {
+	tests := []struct {
+		question string
+		want     TypeHint
+		ok       bool
+	}{
+		{"How many unique customers are there? [integer: count]", TypeHint{Type: TypeInteger, Column: "count"}, true},
+		{"What percentage of orders are late? [float: percentage]", TypeHint{Type: TypeFloat, Column: "percentage"}, true},
+		{"Which cities have sellers? [string[]: city_name]", TypeHint{Type: TypeString, Column: "city_name", List: true}, true},
+		{"How many sellers? [int : n] ", TypeHint{Type: TypeInteger, Column: "n"}, true},
+		{"How many unique customers are there?", TypeHint{}, false},
+		{"Which seller? [uuid: seller_id]", TypeHint{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTypeHint(tt.question)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseTypeHint(%q): expected %+v %v, got: %+v %v", tt.question, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	single := func(v interface{}) ResultSet {
+		return ResultSet{Columns: []string{"value"}, Rows: []map[string]interface{}{{"value": v}}}
+	}
+	many := ResultSet{
+		Columns: []string{"city", "n"},
+		Rows: []map[string]interface{}{
+			{"city": "rio de janeiro", "n": int64(2)},
+			{"city": []byte("sao paulo"), "n": int64(1)},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		result  ResultSet
+		hint    TypeHint
+		want    interface{}
+		wantErr bool
+	}{
+		{"integer", single(int64(3)), TypeHint{Type: TypeInteger}, int64(3), false},
+		{"integer from float", single(4.0), TypeHint{Type: TypeInteger}, int64(4), false},
+		{"integer from text", single("12"), TypeHint{Type: TypeInteger}, int64(12), false},
+		{"fractional integer", single(4.5), TypeHint{Type: TypeInteger}, nil, true},
+		{"float", single(4.5), TypeHint{Type: TypeFloat}, 4.5, false},
+		{"float from integer", single(int64(4)), TypeHint{Type: TypeFloat}, 4.0, false},
+		{"text for float", single("abc"), TypeHint{Type: TypeFloat}, nil, true},
+		{"string", single([]byte("s1")), TypeHint{Type: TypeString}, "s1", false},
+		{"number for string", single(int64(1)), TypeHint{Type: TypeString}, nil, true},
+		{"boolean", single(int64(1)), TypeHint{Type: TypeBoolean}, true, false},
+		{"null", single(nil), TypeHint{Type: TypeFloat}, nil, true},
+		{"hinted column", many, TypeHint{Type: TypeString, Column: "city", List: true}, []interface{}{"rio de janeiro", "sao paulo"}, false},
+		{"list of other column", many, TypeHint{Type: TypeInteger, Column: "N", List: true}, []interface{}{int64(2), int64(1)}, false},
+		{"multiple rows for scalar", many, TypeHint{Type: TypeString, Column: "city"}, nil, true},
+		{"no rows for scalar", ResultSet{Columns: []string{"value"}}, TypeHint{Type: TypeString}, nil, true},
+		{"no rows for list", ResultSet{Columns: []string{"value"}}, TypeHint{Type: TypeString, List: true}, []interface{}{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Coerce(tt.result, tt.hint)
+			if tt.wantErr {
+				var typeErr *AnswerTypeError
+				if !errors.As(err, &typeErr) {
+					t.Fatalf("Expected AnswerTypeError, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Error coercing result: %v", err)
+			}
+			if !reflect.DeepEqual(got.Value, tt.want) {
+				t.Errorf("Expected value: %#v, got: %#v", tt.want, got.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package text2sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ExampleCheck is the outcome of checking one few-shot example against a database.
+type ExampleCheck struct {
+	Example Example `json:"example"`
+	// Error is why the example is broken; empty when it is verified.
+	Error string `json:"error,omitempty"`
+	// Result holds the rows of an executed example.
+	Result *ResultSet `json:"result,omitempty"`
+}
+
+// OK reports whether the example's SQL is valid for the database.
+func (c ExampleCheck) OK() bool {
+	return c.Error == ""
+}
+
+// VerifyOptions configure VerifyExamples.
+type VerifyOptions struct {
+	// Execute runs every answer and checks its result against the question's
+	// type hint. Otherwise answers are only prepared with EXPLAIN QUERY PLAN,
+	// which catches unknown tables and columns without scanning any data.
+	Execute bool
+	Limits  QueryLimits
+}
+
+// VerifyExamples checks the SQL of every example against db, so that broken
+// examples are caught at startup instead of teaching the model wrong joins.
+func VerifyExamples(ctx context.Context, db *sql.DB, examples []Example, opts VerifyOptions) []ExampleCheck {
+	checks := make([]ExampleCheck, len(examples))
+	for i, e := range examples {
+		checks[i] = verifyExample(ctx, db, e, opts)
+	}
+	return checks
+}
+
+func verifyExample(ctx context.Context, db *sql.DB, e Example, opts VerifyOptions) ExampleCheck {
+	check := ExampleCheck{Example: e}
+	if !opts.Execute {
+		if _, err := ExplainQueryPlan(ctx, db, e.Answer); err != nil {
+			check.Error = err.Error()
+		}
+		return check
+	}
+
+	result, err := ExecuteSQLQuery(ctx, db, e.Answer, opts.Limits)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if hint, ok := ParseTypeHint(e.Question); ok {
+		if _, err := Coerce(result, hint); err != nil {
+			check.Error = err.Error()
+			return check
+		}
+	}
+	check.Result = &result
+	return check
+}
+
+// VerifiedExamples returns the examples of the checks that passed.
+func VerifiedExamples(checks []ExampleCheck) []Example {
+	var examples []Example
+	for _, c := range checks {
+		if c.OK() {
+			examples = append(examples, c.Example)
+		}
+	}
+	return examples
+}
+
+// EvalCase turns an executed, verified example into an eval case whose gold
+// result is the rows the example returned. ok is false for other checks.
+func (c ExampleCheck) EvalCase(id string) (EvalCase, bool) {
+	if !c.OK() || c.Result == nil {
+		return EvalCase{}, false
+	}
+	gold := make([][]interface{}, len(c.Result.Rows))
+	for i, row := range c.Result.Rows {
+		values := make([]interface{}, len(c.Result.Columns))
+		for j, col := range c.Result.Columns {
+			values[j] = normalizeValue(row[col])
+		}
+		gold[i] = values
+	}
+	return EvalCase{ID: id, Question: c.Example.Question, GoldColumns: c.Result.Columns, GoldResult: gold}, true
+}
+
+// WriteEvalCases writes cases in the JSONL format read by LoadEvalCases.
+func WriteEvalCases(w io.Writer, cases []EvalCase) error {
+	enc := json.NewEncoder(w)
+	for _, c := range cases {
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf("failed to write eval case %s: %w", c.ID, err)
+		}
+	}
+	return nil
+}
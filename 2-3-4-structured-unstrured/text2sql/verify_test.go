@@ -0,0 +1,86 @@
+package text2sql
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// brokenExample is the original few-shot example, which joins on a column orders does not have.
+var brokenExample = Example{
+	Question: sellerQuestion,
+	Answer:   "SELECT s.seller_id, COUNT(*) AS order_count FROM orders o JOIN customers c ON o.customer_id = c.customer_id JOIN sellers s ON o.seller_id = s.seller_id WHERE c.customer_city = 'rio de janeiro' AND o.order_status = 'delivered' GROUP BY s.seller_id ORDER BY order_count DESC LIMIT 1;",
+}
+
+func TestVerifyExamples(t *testing.T) {
+	db := newTestDB(t)
+	examples := []Example{
+		brokenExample,
+		DefaultExamples[0],
+		{Question: "Which sellers are there? [string: seller_id]", Answer: "SELECT seller_id FROM sellers"},
+		{Question: "Drop the sellers", Answer: "DROP TABLE sellers"},
+	}
+
+	for _, execute := range []bool{false, true} {
+		checks := VerifyExamples(context.Background(), db, examples, VerifyOptions{Execute: execute, Limits: DefaultQueryLimits})
+		if !strings.Contains(checks[0].Error, "no such column: o.seller_id") {
+			t.Errorf("Expected the broken join to be flagged (execute=%v), got: %q", execute, checks[0].Error)
+		}
+		if !checks[1].OK() {
+			t.Errorf("Expected the default example to verify (execute=%v), got: %s", execute, checks[1].Error)
+		}
+		if checks[3].OK() {
+			t.Errorf("Expected a write to be flagged (execute=%v)", execute)
+		}
+		// Only executing the query shows that it returns two sellers for a scalar question.
+		if checks[2].OK() == execute {
+			t.Errorf("Unexpected check of the scalar question (execute=%v): %+v", execute, checks[2])
+		}
+
+		verified := VerifiedExamples(checks)
+		if len(verified) == 0 || verified[0] != DefaultExamples[0] {
+			t.Errorf("Unexpected verified examples (execute=%v): %+v", execute, verified)
+		}
+	}
+}
+
+func TestExampleCheckEvalCase(t *testing.T) {
+	db := newTestDB(t)
+	checks := VerifyExamples(context.Background(), db, []Example{brokenExample, DefaultExamples[0]}, VerifyOptions{Execute: true, Limits: DefaultQueryLimits})
+
+	if _, ok := checks[0].EvalCase("broken"); ok {
+		t.Errorf("Expected no eval case for a broken example")
+	}
+	c, ok := checks[1].EvalCase("rio")
+	if !ok {
+		t.Fatalf("Expected an eval case for a verified example")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteEvalCases(&buf, []EvalCase{c}); err != nil {
+		t.Fatalf("Error writing eval cases: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "eval.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadEvalCases(path)
+	if err != nil {
+		t.Fatalf("Error loading written eval cases: %v", err)
+	}
+	if len(cases) != 1 || cases[0].ID != "rio" || len(cases[0].GoldResult) != 1 {
+		t.Fatalf("Unexpected eval cases: %+v", cases)
+	}
+
+	// The stored result is the gold answer for the example's question.
+	gold, err := goldResult(context.Background(), db, cases[0], DefaultQueryLimits)
+	if err != nil {
+		t.Fatalf("Error reading gold result: %v", err)
+	}
+	if ok, reason := compareResults(*checks[1].Result, gold, "seller_id", DefaultEvalOptions.Tolerance); !ok {
+		t.Errorf("Expected stored result to match: %s", reason)
+	}
+}
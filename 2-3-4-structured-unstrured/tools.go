@@ -0,0 +1,134 @@
+package structuredoutput
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// DefaultMaxToolRounds bounds how often the model may call tools before answering.
+const DefaultMaxToolRounds = 8
+
+// Tool is a function the model can call while answering.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the arguments.
+	Parameters map[string]any
+	// Call runs the tool with the JSON arguments sent by the model and
+	// returns the result shown to the model.
+	Call func(ctx context.Context, args string) (string, error)
+}
+
+// ToolRegistry holds the tools offered to the model (see WithTools).
+type ToolRegistry struct {
+	tools map[string]Tool
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: map[string]Tool{}}
+}
+
+var toolNameValid = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Register adds a tool. It panics on invalid or duplicate names, like http.Handle.
+func (r *ToolRegistry) Register(tool Tool) {
+	if !toolNameValid.MatchString(tool.Name) {
+		panic(fmt.Sprintf("structuredoutput: invalid tool name %q", tool.Name))
+	}
+	if _, ok := r.tools[tool.Name]; ok {
+		panic(fmt.Sprintf("structuredoutput: tool %q registered twice", tool.Name))
+	}
+	r.tools[tool.Name] = tool
+}
+
+// RegisterTool registers fn as a tool whose arguments are described by the
+// JSON schema of A (see GenerateSchema) and whose result is sent back as JSON.
+func RegisterTool[A any, R any](r *ToolRegistry, name string, description string, fn func(context.Context, A) (R, error)) {
+	r.Register(Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  schemaMap(GenerateSchema[A]()),
+		Call: func(ctx context.Context, args string) (string, error) {
+			var a A
+			if err := json.Unmarshal([]byte(args), &a); err != nil {
+				return "", fmt.Errorf("invalid arguments: %w", err)
+			}
+			result, err := fn(ctx, a)
+			if err != nil {
+				return "", err
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				return "", fmt.Errorf("failed to encode result: %w", err)
+			}
+			return string(data), nil
+		},
+	})
+}
+
+// schemaMap converts a reflected schema into the map form of the API params.
+func schemaMap(schema interface{}) map[string]any {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		panic(fmt.Sprintf("structuredoutput: cannot encode tool schema: %v", err))
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		panic(fmt.Sprintf("structuredoutput: cannot decode tool schema: %v", err))
+	}
+	delete(m, "$schema")
+	return m
+}
+
+// Names returns the registered tool names, sorted.
+func (r *ToolRegistry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Params returns the tools as request params, sorted by name.
+func (r *ToolRegistry) Params() []openai.ChatCompletionToolParam {
+	var params []openai.ChatCompletionToolParam
+	for _, name := range r.Names() {
+		tool := r.tools[name]
+		fn := shared.FunctionDefinitionParam{
+			Name:       tool.Name,
+			Parameters: tool.Parameters,
+			Strict:     openai.Bool(true),
+		}
+		if tool.Description != "" {
+			fn.Description = openai.String(tool.Description)
+		}
+		params = append(params, openai.ChatCompletionToolParam{Function: fn})
+	}
+	return params
+}
+
+// Call runs the tool named by call and returns the content of the tool message.
+// Failures are reported to the model as {"error": ...} so it can correct its call.
+func (r *ToolRegistry) Call(ctx context.Context, call openai.ChatCompletionMessageToolCall) string {
+	tool, ok := r.tools[call.Function.Name]
+	if !ok {
+		return toolError(fmt.Errorf("unknown tool %q", call.Function.Name))
+	}
+	result, err := tool.Call(ctx, call.Function.Arguments)
+	if err != nil {
+		return toolError(err)
+	}
+	return result
+}
+
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
@@ -0,0 +1,149 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+type addArgs struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type sumAnswer struct {
+	Value int `json:"value"`
+}
+
+func newTestTools() *ToolRegistry {
+	tools := NewToolRegistry()
+	RegisterTool(tools, "add", "Adds two integers.", func(ctx context.Context, args addArgs) (int, error) {
+		return args.A + args.B, nil
+	})
+	RegisterTool(tools, "fail", "Always fails.", func(ctx context.Context, args struct{}) (string, error) {
+		return "", errors.New("boom")
+	})
+	return tools
+}
+
+func TestGenerateWithTools(t *testing.T) {
+	fake := NewFakeProvider().On("sumAnswer", "",
+		FakeResponse{ToolCalls: []FakeToolCall{
+			{ID: "call_1", Name: "add", Arguments: `{"a":1,"b":2}`},
+			{ID: "call_2", Name: "fail", Arguments: `{}`},
+			{ID: "call_3", Name: "missing", Arguments: `{}`},
+		}},
+		FakeResponse{Content: `{"value":3}`},
+	)
+	conv := NewChatContext(1, WithProvider(fake), WithTools(newTestTools()))
+	conv.AddMessage(openai.UserMessage("What is 1 + 2?"))
+
+	answer, err := Generate[sumAnswer](context.Background(), conv, GenerateOptions{})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if answer.Value != 3 {
+		t.Errorf("Expected value: 3, got: %d", answer.Value)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 model calls, got: %d", len(calls))
+	}
+	if len(calls[0].Tools) != 2 || calls[0].Tools[0].Function.Name != "add" {
+		t.Errorf("Unexpected tools in request: %+v", calls[0].Tools)
+	}
+
+	// user, assistant tool calls, three tool results
+	sent := calls[1].Messages
+	if len(sent) != 5 || len(sent[1].OfAssistant.ToolCalls) != 3 {
+		t.Fatalf("Expected the tool calls and results in the follow-up, got: %d messages", len(sent))
+	}
+	results := []string{
+		sent[2].OfTool.Content.OfString.Value,
+		sent[3].OfTool.Content.OfString.Value,
+		sent[4].OfTool.Content.OfString.Value,
+	}
+	want := []string{`3`, `{"error":"boom"}`, `{"error":"unknown tool \"missing\""}`}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Expected tool results: %v, got: %v", want, results)
+	}
+	if sent[4].OfTool.ToolCallID != "call_3" {
+		t.Errorf("Expected tool call id: call_3, got: %s", sent[4].OfTool.ToolCallID)
+	}
+	if got := len(conv.Memory.Messages); got != 6 {
+		t.Errorf("Expected the answer appended after the tool results, got: %d messages", got)
+	}
+}
+
+func TestGenerateWithToolsMaxRounds(t *testing.T) {
+	fake := NewFakeProvider().On("sumAnswer", "",
+		FakeResponse{ToolCalls: []FakeToolCall{{ID: "call_1", Name: "add", Arguments: `{"a":1,"b":2}`}}},
+	)
+	conv := NewChatContext(1, WithProvider(fake), WithTools(newTestTools()), WithMaxToolRounds(2))
+	conv.AddMessage(openai.UserMessage("What is 1 + 2?"))
+
+	_, err := Generate[sumAnswer](context.Background(), conv, GenerateOptions{})
+	if err == nil || !strings.Contains(err.Error(), "still calling tools after 2 rounds") {
+		t.Errorf("Expected the tool round limit, got: %v", err)
+	}
+	if got := len(fake.Calls()); got != 3 {
+		t.Errorf("Expected 3 model calls, got: %d", got)
+	}
+}
+
+func TestToolParams(t *testing.T) {
+	params := newTestTools().Params()
+	fn := params[0].Function
+	if fn.Name != "add" || fn.Description.Value != "Adds two integers." || !fn.Strict.Value {
+		t.Errorf("Unexpected tool definition: %+v", fn)
+	}
+	if fn.Parameters["additionalProperties"] != false {
+		t.Errorf("Expected a strict parameter schema, got: %v", fn.Parameters)
+	}
+	if _, ok := fn.Parameters["$schema"]; ok {
+		t.Errorf("Expected no $schema in tool parameters")
+	}
+	required, _ := fn.Parameters["required"].([]any)
+	if len(required) != 2 {
+		t.Errorf("Expected a and b to be required, got: %v", fn.Parameters["required"])
+	}
+}
+
+func TestRegisterToolTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for a duplicate tool")
+		}
+	}()
+	tools := newTestTools()
+	RegisterTool(tools, "add", "", func(ctx context.Context, args addArgs) (int, error) { return 0, nil })
+}
+
+func TestMemoryRecordsToolCalls(t *testing.T) {
+	call := openai.ChatCompletionMessage{ToolCalls: []openai.ChatCompletionMessageToolCall{{
+		ID:       "call_1",
+		Function: openai.ChatCompletionMessageToolCallFunction{Name: "add", Arguments: `{"a":1,"b":2}`},
+	}}}
+	memory := Memory{Messages: []openai.ChatCompletionMessageParamUnion{call.ToParam(), openai.ToolMessage("3", "call_1")}}
+
+	records, err := memory.Records()
+	if err != nil {
+		t.Fatalf("Records: %v", err)
+	}
+	restored, err := MemoryFromRecords(records)
+	if err != nil {
+		t.Fatalf("MemoryFromRecords: %v", err)
+	}
+	again, _ := restored.Records()
+	if !reflect.DeepEqual(records, again) || len(records[0].ToolCalls) != 1 {
+		t.Errorf("Expected tool calls to survive a round trip, got: %+v", again)
+	}
+	if !restored.Messages[0].OfAssistant.Content.OfString.IsOmitted() {
+		t.Errorf("Expected no content for a tool call message")
+	}
+}
@@ -2,14 +2,17 @@ package unstructuredprocessor
 
 import (
 	"bytes"
+	"context"
+	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	structuredoutput "llmdojo"
-	"log"
+	"net/mail"
 	"os"
 	"strings"
 
-	"github.com/invopop/jsonschema"
 	"github.com/ledongthuc/pdf"
 	"github.com/openai/openai-go"
 )
@@ -106,44 +109,68 @@ type OpenSourceProjects []struct {
 	GithubLink  string `json:"githubLink" jsonschema:"description=The GitHub link to the open source project"`
 }
 
-var docClassificationSchema = openai.ResponseFormatJSONSchemaJSONSchemaParam{
+// maxModelRetries is how often a malformed or invalid model answer is sent back for correction.
+const maxModelRetries = 2
+
+var docClassificationFormat = structuredoutput.GenerateOptions{
 	Name:        "DocClassification",
-	Description: openai.String("Classify the document into one of the following categories: Resume, Cover Letter, or Unknown."),
-	Schema:      GenerateSchema[DocClassification](),
-	Strict:      openai.Bool(true),
+	Description: "Classify the document into one of the following categories: Resume, Cover Letter, or Unknown.",
+	MaxRetries:  maxModelRetries,
 }
 
-var ResumeFeaturesSchema = openai.ResponseFormatJSONSchemaJSONSchemaParam{
+var resumeFeaturesFormat = structuredoutput.GenerateOptions{
 	Name:        "ResumeFeatures",
-	Description: openai.String("Extract features from the resume."),
-	Schema:      GenerateSchema[ResumeFeatures](),
-	Strict:      openai.Bool(true),
+	Description: "Extract features from the resume.",
+	MaxRetries:  maxModelRetries,
 }
 
-func GenerateSchema[T any]() interface{} {
+func init() {
+	structuredoutput.RegisterValidator(ValidateResumeFeatures)
+}
 
-	reflector := jsonschema.Reflector{
-		AllowAdditionalProperties: false,
-		DoNotReference:            true,
-	}
-	var v T
-	schema := reflector.Reflect(v)
-	return schema
+//go:embed prompts
+var promptFiles embed.FS
+
+// Names of the system prompts in Prompts.
+const (
+	ClassifyPromptName = "classify-document"
+	ExtractPromptName  = "extract-resume"
+)
+
+// PromptData are the variables of the system prompts.
+type PromptData struct {
+	// DocType is the type of the document being extracted.
+	DocType DocType
 }
 
-// ClassifyDocument classifies the document content into one of the predefined categories.
-// It uses the OpenAI API to generate a response based on the provided content.
-// The function returns the classified document type or an error if the classification fails.
-// The function takes a string parameter 'content' which contains the text of the document to be classified.
-// It returns a DocType representing the classified document type and an error if any occurs during the classification process.
-// The function uses a structured output format to define the expected response schema.
-func ClassifyDocument(content string) (DocType, error) {
+// Prompts hold the system prompts, loaded from prompts/ with one directory per
+// prompt and a template file per version. Choose a version with Prompts.Use.
+var Prompts = loadPrompts()
+
+func loadPrompts() *structuredoutput.PromptRegistry {
+	prompts := structuredoutput.NewPromptRegistry()
+	dir, err := fs.Sub(promptFiles, "prompts")
+	if err == nil {
+		err = prompts.Load(dir)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("unstructuredprocessor: embedded prompts: %v", err))
+	}
+	return prompts
+}
 
-	conv := structuredoutput.NewChatContext(1)
+// newPromptedContext starts a conversation with the system prompt name,
+// rendered for data, and the document content.
+func newPromptedContext(name string, data PromptData, content string, opts []structuredoutput.Option) (*structuredoutput.ChatContext, *structuredoutput.Prompt, error) {
+	system, prompt, err := Prompts.Render(name, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	conv := structuredoutput.NewChatContext(1, opts...)
 	conv.AddMessage(openai.ChatCompletionMessageParamUnion{
 		OfSystem: &openai.ChatCompletionSystemMessageParam{
 			Content: openai.ChatCompletionSystemMessageParamContentUnion{
-				OfString: openai.String("You are a document classification expert. Classify the document into one of the following categories: Resume, Cover Letter, or Unknown."),
+				OfString: openai.String(system),
 			},
 		},
 	})
@@ -155,25 +182,65 @@ func ClassifyDocument(content string) (DocType, error) {
 			},
 		},
 	})
+	return conv, prompt, nil
+}
 
-	agentResp, err := conv.GenerateResponseFromModel(docClassificationSchema)
-	if err != nil {
-		return "", fmt.Errorf("error generating response from model: %v", err)
+// ValidateResumeFeatures rejects extractions with a malformed email address or
+// negative experience and salary figures. Missing values are allowed.
+func ValidateResumeFeatures(r ResumeFeatures) error {
+	var errs []error
+	if r.Contact.Email != "" {
+		addr, err := mail.ParseAddress(r.Contact.Email)
+		if err != nil || addr.Address != r.Contact.Email {
+			errs = append(errs, fmt.Errorf("contact.email %q is not a valid email address", r.Contact.Email))
+		}
+	}
+	if r.YearsOfExperience < 0 {
+		errs = append(errs, fmt.Errorf("yearsOfExperience must not be negative, got %v", r.YearsOfExperience))
 	}
+	if r.SalaryExpectation < 0 {
+		errs = append(errs, fmt.Errorf("salaryExpectation must not be negative, got %v", r.SalaryExpectation))
+	}
+	return errors.Join(errs...)
+}
+
+var ResumeFeaturesSchema = structuredoutput.ResponseSchema[ResumeFeatures](resumeFeaturesFormat.Name, resumeFeaturesFormat.Description)
+
+// GenerateSchema reflects T into a strict JSON schema, see structuredoutput.GenerateSchema.
+func GenerateSchema[T any]() interface{} {
+	return structuredoutput.GenerateSchema[T]()
+}
+
+// ClassifyDocument classifies the document content into one of the predefined categories.
+// It uses the OpenAI API to generate a response based on the provided content.
+// The function returns the classified document type or an error if the classification fails.
+// The function takes a string parameter 'content' which contains the text of the document to be classified.
+// It returns a DocType representing the classified document type and an error if any occurs during the classification process.
+// The function uses a structured output format to define the expected response schema.
+func ClassifyDocument(content string) (DocType, error) {
+	return ClassifyDocumentContext(context.Background(), content)
+}
 
-	var response structuredoutput.ModelResp
-	if err := json.Unmarshal([]byte(agentResp), &response); err != nil {
-		log.Printf("Error unmarshalling response: %v", err)
-		return "", err
+// ClassifyDocumentContext is ClassifyDocument bounded by ctx.
+// The opts configure the conversation, e.g. its provider, model or timeout.
+func ClassifyDocumentContext(ctx context.Context, content string, opts ...structuredoutput.Option) (DocType, error) {
+	docType, _, err := classifyDocument(ctx, content, opts)
+	return docType, err
+}
+
+// classifyDocument is ClassifyDocumentContext returning the prompt it used.
+func classifyDocument(ctx context.Context, content string, opts []structuredoutput.Option) (DocType, *structuredoutput.Prompt, error) {
+	conv, prompt, err := newPromptedContext(ClassifyPromptName, PromptData{}, content, opts)
+	if err != nil {
+		return "", nil, err
 	}
 
-	var docTypeResponse DocClassification
-	if err := json.Unmarshal([]byte(response.Content), &docTypeResponse); err != nil {
-		log.Printf("Error unmarshalling document type response: %v", err)
-		return "", err
+	docTypeResponse, err := structuredoutput.Generate[DocClassification](ctx, conv, docClassificationFormat)
+	if err != nil {
+		return "", prompt, fmt.Errorf("error generating response from model: %w", err)
 	}
 
-	return docTypeResponse.DocType, nil
+	return docTypeResponse.DocType, prompt, nil
 }
 
 // ExtractDataFromResume extracts data from the resume content.
@@ -183,70 +250,105 @@ func ClassifyDocument(content string) (DocType, error) {
 // It returns a pointer to a ResumeFeatures struct and an error if any occurs during the extraction process.
 // The function uses a structured output format to define the expected response schema.
 func ExtractDataFromResume(content string) (*ResumeFeatures, error) {
+	return ExtractDataFromResumeContext(context.Background(), content)
+}
 
-	conv := structuredoutput.NewChatContext(1)
-	conv.AddMessage(openai.ChatCompletionMessageParamUnion{
-		OfSystem: &openai.ChatCompletionSystemMessageParam{
-			Content: openai.ChatCompletionSystemMessageParamContentUnion{
-				OfString: openai.String("You are a resume data extraction expert. Extract the following information from the resume: contact information, education, years of experience, skills, and work experience."),
-			},
-		},
-	})
-
-	conv.AddMessage(openai.ChatCompletionMessageParamUnion{
-		OfUser: &openai.ChatCompletionUserMessageParam{
-			Content: openai.ChatCompletionUserMessageParamContentUnion{
-				OfString: openai.String(content),
-			},
-		},
-	})
+// ExtractDataFromResumeContext is ExtractDataFromResume bounded by ctx.
+// The opts configure the conversation, e.g. its provider, model or timeout.
+func ExtractDataFromResumeContext(ctx context.Context, content string, opts ...structuredoutput.Option) (*ResumeFeatures, error) {
+	resumeData, _, err := extractDataFromResume(ctx, content, opts)
+	return resumeData, err
+}
 
-	agentResp, err := conv.GenerateResponseFromModel(ResumeFeaturesSchema)
+// extractDataFromResume is ExtractDataFromResumeContext returning the prompt it used.
+func extractDataFromResume(ctx context.Context, content string, opts []structuredoutput.Option) (*ResumeFeatures, *structuredoutput.Prompt, error) {
+	conv, prompt, err := newPromptedContext(ExtractPromptName, PromptData{DocType: RESUME}, content, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error generating response from model: %v", err)
-	}
-	var response structuredoutput.ModelResp
-	if err := json.Unmarshal([]byte(agentResp), &response); err != nil {
-		log.Printf("Error unmarshalling response: %v", err)
-		return nil, err
+		return nil, nil, err
 	}
-	var resumeData ResumeFeatures
-	if err := json.Unmarshal([]byte(response.Content), &resumeData); err != nil {
-		log.Printf("Error unmarshalling resume data response: %v", err)
-		return nil, err
+
+	resumeData, err := structuredoutput.Generate[ResumeFeatures](ctx, conv, resumeFeaturesFormat)
+	if err != nil {
+		return nil, prompt, fmt.Errorf("error generating response from model: %w", err)
 	}
 
-	return &resumeData, nil
+	return &resumeData, prompt, nil
 }
 
+// ExtractFeatures classifies the PDF at path doc and extracts its features.
 func ExtractFeatures(doc string) (DocType, DocDescriptor, error) {
-	content, err := ReadPDFContent("../AD-Resume-v4.pdf")
+	return ExtractFeaturesContext(context.Background(), doc)
+}
+
+// ExtractFeaturesContext is ExtractFeatures bounded by ctx. The opts apply to
+// both the classification and the extraction conversations.
+func ExtractFeaturesContext(ctx context.Context, doc string, opts ...structuredoutput.Option) (DocType, DocDescriptor, error) {
+	docType, features, _, err := extractFeatures(ctx, doc, opts)
+	return docType, features, err
+}
+
+// extractFeatures is ExtractFeaturesContext also returning the versions of
+// the prompts it used (see Prompt.String).
+func extractFeatures(ctx context.Context, doc string, opts []structuredoutput.Option) (DocType, DocDescriptor, []string, error) {
+	content, err := ReadPDFContent(doc)
 	if err != nil {
 		fmt.Println("Error:", err)
-		return "", nil, err
+		return "", nil, nil, err
 	}
 	// fmt.Println("PDF Content:", content)
 
-	docType, err := ClassifyDocument(content)
+	docType, prompt, err := classifyDocument(ctx, content, opts)
 	if err != nil {
 		fmt.Println("Error:", err)
-		return "", nil, err
+		return "", nil, nil, err
 	}
+	prompts := []string{prompt.String()}
 	fmt.Println("Document Type:", docType)
 
 	switch strings.ToUpper(string(docType)) {
 	case string(RESUME):
-		resumeData, err := ExtractDataFromResume(content)
+		resumeData, prompt, err := extractDataFromResume(ctx, content, opts)
+		if prompt != nil {
+			prompts = append(prompts, prompt.String())
+		}
 		if err != nil {
 			fmt.Println("Error:", err)
-			return "", nil, err
+			return "", nil, prompts, err
 		}
 		fmt.Printf("Resume Data: %+v\n", resumeData)
-		return RESUME, resumeData, nil
+		return RESUME, resumeData, prompts, nil
 
 	default:
 		fmt.Print("This document type is not classified.")
-		return UNKNOWN, nil, fmt.Errorf("unknown document type")
+		return UNKNOWN, nil, prompts, fmt.Errorf("unknown document type")
 	}
 
 }
+
+// ExtractedDoc is the outcome of ExtractFeaturesBatch for one document.
+type ExtractedDoc struct {
+	Path     string
+	Type     DocType
+	Features DocDescriptor
+	// Prompts are the versions of the prompts used, e.g. "extract-resume@v1".
+	Prompts []string
+	Err     error
+}
+
+// ExtractFeaturesBatch runs ExtractFeaturesContext for the PDFs at paths, workers
+// at once, and returns the results in the order of paths. Pass a shared
+// structuredoutput.WithRateLimiter in opts to stay within the provider's limits.
+func ExtractFeaturesBatch(ctx context.Context, paths []string, workers int, opts ...structuredoutput.Option) []ExtractedDoc {
+	results := structuredoutput.RunBatch(ctx, paths, workers, func(ctx context.Context, path string) (ExtractedDoc, error) {
+		docType, features, prompts, err := extractFeatures(ctx, path, opts)
+		return ExtractedDoc{Path: path, Type: docType, Features: features, Prompts: prompts}, err
+	})
+
+	docs := make([]ExtractedDoc, len(results))
+	for i, r := range results {
+		docs[i] = r.Value
+		docs[i].Path = paths[i]
+		docs[i].Err = r.Err
+	}
+	return docs
+}
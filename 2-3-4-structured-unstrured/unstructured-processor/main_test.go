@@ -1,12 +1,25 @@
 package unstructuredprocessor
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	structuredoutput "llmdojo"
 	"math"
+	"os"
 	"slices"
+	"strings"
 	"testing"
 )
 
+// useProvider points every conversation created during the test at p.
+func useProvider(t *testing.T, p structuredoutput.Provider) {
+	t.Helper()
+	prev := structuredoutput.DefaultProvider()
+	structuredoutput.SetDefaultProvider(p)
+	t.Cleanup(func() { structuredoutput.SetDefaultProvider(prev) })
+}
+
 var resumeEvals = []struct {
 	Resume         string
 	ActualFeatures ResumeFeatures
@@ -51,15 +64,28 @@ var resumeEvals = []struct {
 	},
 }
 
+// TestResumeFeatureExtraction scores the live model's extraction of the sample
+// resumes. It calls the provider configured by the environment (see
+// NewProviderFromEnv), so it only runs with LLMDOJO_LIVE=1.
 func TestResumeFeatureExtraction(t *testing.T) {
+	if os.Getenv("LLMDOJO_LIVE") == "" {
+		t.Skip("set LLMDOJO_LIVE=1 to evaluate the live model")
+	}
+	provider, err := structuredoutput.NewProviderFromEnv()
+	if err != nil {
+		t.Fatalf("Error creating provider: %v", err)
+	}
 
+	// The usage of the whole batch is rolled up like a pipeline run.
+	usage := structuredoutput.NewUsageTracker()
 	for id, eval := range resumeEvals {
 		content, err := ReadPDFContent(eval.Resume)
 		if err != nil {
 			t.Fatalf("Error reading PDF content: %v", err)
 		}
 
-		resumeData, err := ExtractDataFromResume(content)
+		resumeData, err := ExtractDataFromResumeContext(context.Background(), content,
+			structuredoutput.WithProvider(provider), structuredoutput.WithUsage(usage))
 		if err != nil {
 			t.Fatalf("Error extracting data from resume: %v", err)
 		}
@@ -113,4 +139,129 @@ func TestResumeFeatureExtraction(t *testing.T) {
 		fmt.Printf("eval %d Accuracy Score: %d/8\n", id, eval.AccuracyScore)
 	}
 
+	if got := usage.Total().Calls; got != len(resumeEvals) {
+		t.Errorf("Expected %d model calls, got: %d", len(resumeEvals), got)
+	}
+	fmt.Printf("Usage: %s\n", usage.Total())
+	fmt.Printf("Estimated cost: %s\n", structuredoutput.FormatCost(usage.Cost(structuredoutput.DefaultPrices)))
+
+}
+
+func TestExtractDataFromResumePrompt(t *testing.T) {
+	fake := structuredoutput.NewFakeProvider().OnSchema("ResumeFeatures",
+		`{"firstName":"John","lastName":"Doe","contact":{"email":"john@example.com","phone":""},"education":[],"yearsOfExperience":3,"skills":[],"workExperience":[],"salaryExpectation":0,"location":"","openSourceProjects":[]}`)
+	eval := resumeEvals[0]
+	content, err := ReadPDFContent(eval.Resume)
+	if err != nil {
+		t.Fatalf("Error reading PDF content: %v", err)
+	}
+
+	if _, err := ExtractDataFromResumeContext(context.Background(), content, structuredoutput.WithProvider(fake)); err != nil {
+		t.Fatalf("Error extracting data from resume: %v", err)
+	}
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 model call, got: %d", len(calls))
+	}
+	prompt, err := json.Marshal(calls[0].Messages)
+	if err != nil {
+		t.Fatalf("Error encoding prompt: %v", err)
+	}
+	if !strings.Contains(string(prompt), eval.ActualFeatures.Contact.Email) {
+		t.Errorf("Expected the resume text of %s in the prompt", eval.Resume)
+	}
+}
+
+func TestClassifyDocument(t *testing.T) {
+	fake := structuredoutput.NewFakeProvider().
+		OnSchema("DocClassification", `{"docType":"COVER_LETTER"}`)
+	useProvider(t, fake)
+
+	docType, err := ClassifyDocument("Dear hiring manager, ...")
+	if err != nil {
+		t.Fatalf("Error classifying document: %v", err)
+	}
+	if docType != COVER_LETTER {
+		t.Errorf("Expected DocType: %s, got: %s", COVER_LETTER, docType)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 model call, got: %d", len(calls))
+	}
+	if len(calls[0].Messages) != 2 {
+		t.Errorf("Expected system and user messages, got: %d messages", len(calls[0].Messages))
+	}
+}
+
+func TestExtractFeaturesBatch(t *testing.T) {
+	fake := structuredoutput.NewFakeProvider().
+		OnSchema("DocClassification", `{"docType":"RESUME"}`).
+		OnSchema("ResumeFeatures", `{"firstName":"John","lastName":"Doe","contact":{"email":"john@example.com","phone":""},"education":[],"yearsOfExperience":3,"skills":[],"workExperience":[],"salaryExpectation":0,"location":"","openSourceProjects":[]}`)
+	usage := structuredoutput.NewUsageTracker()
+
+	paths := []string{resumeEvals[0].Resume, "missing.pdf", resumeEvals[1].Resume}
+	docs := ExtractFeaturesBatch(context.Background(), paths, 2,
+		structuredoutput.WithProvider(fake),
+		structuredoutput.WithUsage(usage),
+		structuredoutput.WithRateLimiter(structuredoutput.NewRateLimiter(0, 0)))
+
+	for i, doc := range docs {
+		if doc.Path != paths[i] {
+			t.Errorf("Expected Path: %s, got: %s", paths[i], doc.Path)
+		}
+	}
+	if docs[1].Err == nil {
+		t.Error("Expected an error for the missing PDF")
+	}
+	for _, doc := range []ExtractedDoc{docs[0], docs[2]} {
+		if doc.Err != nil || doc.Type != RESUME || doc.Features.(*ResumeFeatures).FirstName != "John" {
+			t.Errorf("Expected the resume of %s, got: %+v", doc.Path, doc)
+		}
+		if !slices.Equal(doc.Prompts, []string{"classify-document@v1", "extract-resume@v1"}) {
+			t.Errorf("Expected the prompt versions, got: %v", doc.Prompts)
+		}
+	}
+	if got := usage.Total().Calls; got != 4 {
+		t.Errorf("Expected 4 model calls, got: %d", got)
+	}
+}
+
+func TestExtractDataFromResumeInvalidResponse(t *testing.T) {
+	useProvider(t, structuredoutput.NewFakeProvider().OnSchema("ResumeFeatures", `{"firstName":`))
+
+	if _, err := ExtractDataFromResume("John Doe"); err == nil {
+		t.Fatal("Expected error for malformed model response")
+	}
+}
+
+func TestExtractDataFromResumeRetriesInvalidEmail(t *testing.T) {
+	fake := structuredoutput.NewFakeProvider().OnSchema("ResumeFeatures",
+		`{"firstName":"John","lastName":"Doe","contact":{"email":"john at example.com","phone":""},"education":[],"yearsOfExperience":3,"skills":[],"workExperience":[],"salaryExpectation":0,"location":"","openSourceProjects":[]}`,
+		`{"firstName":"John","lastName":"Doe","contact":{"email":"john@example.com","phone":""},"education":[],"yearsOfExperience":3,"skills":[],"workExperience":[],"salaryExpectation":0,"location":"","openSourceProjects":[]}`,
+	)
+	useProvider(t, fake)
+
+	resumeData, err := ExtractDataFromResume("John Doe, john@example.com")
+	if err != nil {
+		t.Fatalf("Error extracting data from resume: %v", err)
+	}
+	if resumeData.Contact.Email != "john@example.com" {
+		t.Errorf("Expected Email: john@example.com, got: %s", resumeData.Contact.Email)
+	}
+	if len(fake.Calls()) != 2 {
+		t.Errorf("Expected 2 model calls, got: %d", len(fake.Calls()))
+	}
+}
+
+func TestValidateResumeFeatures(t *testing.T) {
+	valid := ResumeFeatures{Contact: Contact{Email: "jane@example.com"}, YearsOfExperience: 4}
+	if err := ValidateResumeFeatures(valid); err != nil {
+		t.Errorf("Expected valid resume, got: %v", err)
+	}
+
+	invalid := ResumeFeatures{Contact: Contact{Email: "Jane <jane@example.com>"}, YearsOfExperience: -1}
+	if err := ValidateResumeFeatures(invalid); err == nil {
+		t.Error("Expected errors for display-name email and negative experience")
+	}
 }
@@ -0,0 +1,214 @@
+package structuredoutput
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// Usage counts the tokens and time spent on model calls.
+type Usage struct {
+	Calls            int   `json:"calls"`
+	PromptTokens     int64 `json:"promptTokens"`
+	CompletionTokens int64 `json:"completionTokens"`
+	// CachedTokens are the prompt tokens served from the provider's prompt cache.
+	CachedTokens int64         `json:"cachedTokens"`
+	Latency      time.Duration `json:"latency"`
+}
+
+// Add returns the sum of u and o.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		Calls:            u.Calls + o.Calls,
+		PromptTokens:     u.PromptTokens + o.PromptTokens,
+		CompletionTokens: u.CompletionTokens + o.CompletionTokens,
+		CachedTokens:     u.CachedTokens + o.CachedTokens,
+		Latency:          u.Latency + o.Latency,
+	}
+}
+
+// Sub returns the usage added to o to reach u.
+func (u Usage) Sub(o Usage) Usage {
+	return Usage{
+		Calls:            u.Calls - o.Calls,
+		PromptTokens:     u.PromptTokens - o.PromptTokens,
+		CompletionTokens: u.CompletionTokens - o.CompletionTokens,
+		CachedTokens:     u.CachedTokens - o.CachedTokens,
+		Latency:          u.Latency - o.Latency,
+	}
+}
+
+func (u Usage) TotalTokens() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func (u Usage) String() string {
+	return fmt.Sprintf("%d tokens (prompt %d, cached %d, completion %d) in %d calls, %s",
+		u.TotalTokens(), u.PromptTokens, u.CachedTokens, u.CompletionTokens, u.Calls, u.Latency.Round(time.Millisecond))
+}
+
+// CallUsage is the usage of one model call.
+type CallUsage struct {
+	Model string `json:"model"`
+	Usage
+	// Cached is set when the answer came from the ResponseCache; it has no usage
+	// and is not passed on to the UsageTracker.
+	Cached bool `json:"cached,omitempty"`
+}
+
+func newCallUsage(model string, resp *openai.ChatCompletion, latency time.Duration) CallUsage {
+	if resp.Model != "" {
+		model = resp.Model
+	}
+	return CallUsage{
+		Model: model,
+		Usage: Usage{
+			Calls:            1,
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			CachedTokens:     resp.Usage.PromptTokensDetails.CachedTokens,
+			Latency:          latency,
+		},
+	}
+}
+
+// TotalUsage sums the usage of the conversation's model calls.
+func (c *ChatContext) TotalUsage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total Usage
+	for _, call := range c.Calls {
+		total = total.Add(call.Usage)
+	}
+	return total
+}
+
+// UsageTracker rolls up the usage of many conversations, e.g. of an eval run,
+// per model. It is safe for concurrent use; see WithUsage.
+type UsageTracker struct {
+	mu      sync.Mutex
+	byModel map[string]Usage
+}
+
+func NewUsageTracker() *UsageTracker {
+	return &UsageTracker{byModel: map[string]Usage{}}
+}
+
+func (t *UsageTracker) Record(call CallUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.byModel[call.Model] = t.byModel[call.Model].Add(call.Usage)
+}
+
+// ByModel returns the usage per model.
+func (t *UsageTracker) ByModel() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byModel := make(map[string]Usage, len(t.byModel))
+	for model, u := range t.byModel {
+		byModel[model] = u
+	}
+	return byModel
+}
+
+func (t *UsageTracker) Total() Usage {
+	var total Usage
+	for _, u := range t.ByModel() {
+		total = total.Add(u)
+	}
+	return total
+}
+
+// Cost estimates the cost of the tracked usage; see PriceTable.Cost.
+func (t *UsageTracker) Cost(prices PriceTable) (float64, []string) {
+	return prices.Cost(t.ByModel())
+}
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	// CachedPrompt defaults to Prompt.
+	CachedPrompt float64 `json:"cachedPrompt,omitempty"`
+}
+
+// PriceTable maps model names to prices. Dated model versions such as
+// "gpt-4o-2024-08-06" use the price of their base name.
+type PriceTable map[string]Price
+
+// DefaultPrices are the OpenAI list prices of common models.
+var DefaultPrices = PriceTable{
+	"gpt-4o":       {Prompt: 2.50, Completion: 10.00, CachedPrompt: 1.25},
+	"gpt-4o-mini":  {Prompt: 0.15, Completion: 0.60, CachedPrompt: 0.075},
+	"gpt-4.1":      {Prompt: 2.00, Completion: 8.00, CachedPrompt: 0.50},
+	"gpt-4.1-mini": {Prompt: 0.40, Completion: 1.60, CachedPrompt: 0.10},
+	"gpt-4.1-nano": {Prompt: 0.10, Completion: 0.40, CachedPrompt: 0.025},
+	"o3-mini":      {Prompt: 1.10, Completion: 4.40, CachedPrompt: 0.55},
+}
+
+// LoadPriceTable reads a JSON object of model names to prices, e.g.
+// {"gpt-4o": {"prompt": 2.5, "completion": 10, "cachedPrompt": 1.25}}.
+func LoadPriceTable(path string) (PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices PriceTable
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", path, err)
+	}
+	return prices, nil
+}
+
+// Lookup returns the price of model, falling back to the longest name in the
+// table that model extends with a "-" suffix.
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+	best := ""
+	for name := range t {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	price, ok := t[best]
+	return price, ok && best != ""
+}
+
+// Cost estimates the cost in USD of the usage per model. Models missing
+// from the table are not counted and returned, sorted.
+func (t PriceTable) Cost(byModel map[string]Usage) (float64, []string) {
+	cost := 0.0
+	var unpriced []string
+	for model, u := range byModel {
+		price, ok := t.Lookup(model)
+		if !ok {
+			unpriced = append(unpriced, model)
+			continue
+		}
+		cached := price.CachedPrompt
+		if cached == 0 {
+			cached = price.Prompt
+		}
+		cost += (float64(u.PromptTokens-u.CachedTokens)*price.Prompt +
+			float64(u.CachedTokens)*cached +
+			float64(u.CompletionTokens)*price.Completion) / 1e6
+	}
+	sort.Strings(unpriced)
+	return cost, unpriced
+}
+
+// FormatCost renders an estimated cost, naming the models without a price.
+func FormatCost(cost float64, unpriced []string) string {
+	if len(unpriced) == 0 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.4f (no price for %s)", cost, strings.Join(unpriced, ", "))
+}
@@ -0,0 +1,84 @@
+package structuredoutput
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestPriceTableCost(t *testing.T) {
+	byModel := map[string]Usage{
+		"gpt-4o-2024-08-06": {Calls: 2, PromptTokens: 1_000_000, CachedTokens: 400_000, CompletionTokens: 100_000},
+		"gpt-4o-mini":       {Calls: 1, PromptTokens: 1_000_000, CompletionTokens: 1_000_000},
+		"llama3.2":          {Calls: 1, PromptTokens: 500},
+	}
+	cost, unpriced := DefaultPrices.Cost(byModel)
+
+	// gpt-4o: 0.6M * 2.50 + 0.4M * 1.25 + 0.1M * 10; gpt-4o-mini: 0.15 + 0.60
+	want := 1.5 + 0.5 + 1.0 + 0.75
+	if math.Abs(cost-want) > 1e-9 {
+		t.Errorf("Expected cost: %v, got: %v", want, cost)
+	}
+	if !reflect.DeepEqual(unpriced, []string{"llama3.2"}) {
+		t.Errorf("Expected unpriced: [llama3.2], got: %v", unpriced)
+	}
+
+	if price, ok := DefaultPrices.Lookup("gpt-4o-mini-2024-07-18"); !ok || price != DefaultPrices["gpt-4o-mini"] {
+		t.Errorf("Expected the gpt-4o-mini price, got: %+v", price)
+	}
+	if _, ok := DefaultPrices.Lookup("gpt-4"); ok {
+		t.Error("Expected no price for gpt-4")
+	}
+}
+
+func TestLoadPriceTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"llama3.2": {"prompt": 0.1, "completion": 0.2}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := LoadPriceTable(path)
+	if err != nil {
+		t.Fatalf("LoadPriceTable: %v", err)
+	}
+	cost, unpriced := prices.Cost(map[string]Usage{"llama3.2": {PromptTokens: 1_000_000, CachedTokens: 1_000_000}})
+	if math.Abs(cost-0.1) > 1e-9 || unpriced != nil {
+		t.Errorf("Expected cached tokens at the prompt price, got: %v %v", cost, unpriced)
+	}
+}
+
+func TestChatContextUsage(t *testing.T) {
+	fake := NewFakeProvider().On("sumAnswer", "",
+		FakeResponse{ToolCalls: []FakeToolCall{{ID: "call_1", Name: "add", Arguments: `{"a":1,"b":2}`}}},
+		FakeResponse{Content: `{"value":3}`},
+	)
+	usage := NewUsageTracker()
+	conv := NewChatContext(1, WithProvider(fake), WithTools(newTestTools()), WithUsage(usage))
+	conv.AddMessage(openai.UserMessage("What is 1 + 2?"))
+
+	if _, err := Generate[sumAnswer](context.Background(), conv, GenerateOptions{}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	if len(conv.Calls) != 2 || conv.Calls[0].Model != "fake" {
+		t.Fatalf("Expected 2 recorded calls, got: %+v", conv.Calls)
+	}
+	if conv.Calls[1].PromptTokens <= conv.Calls[0].PromptTokens {
+		t.Errorf("Expected the tool results to add prompt tokens, got: %+v", conv.Calls)
+	}
+	if conv.Calls[1].CompletionTokens != int64(CountTokens(`{"value":3}`)) {
+		t.Errorf("Unexpected completion tokens: %d", conv.Calls[1].CompletionTokens)
+	}
+
+	total := conv.TotalUsage()
+	if got := usage.ByModel()["fake"]; got != total || total.Calls != 2 {
+		t.Errorf("Expected the tracker to match the conversation: %+v, got: %+v", total, got)
+	}
+	if diff := total.Sub(conv.Calls[0].Usage); diff != conv.Calls[1].Usage {
+		t.Errorf("Expected the second call, got: %+v", diff)
+	}
+}
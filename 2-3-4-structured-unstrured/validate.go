@@ -0,0 +1,66 @@
+package structuredoutput
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Validator is implemented by response types that check their own semantics.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned when a decoded response fails a validator.
+type ValidationError struct {
+	Schema string
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("model response for schema %s failed validation: %v", e.Schema, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+var validators = map[reflect.Type][]func(any) error{}
+var validatorsMu sync.RWMutex
+
+// RegisterValidator adds a semantic check that Generate runs on every decoded T.
+// Several validators may be registered for the same type; all of them must pass.
+func RegisterValidator[T any](fn func(T) error) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	t := reflect.TypeFor[T]()
+	validators[t] = append(validators[t], func(v any) error {
+		return fn(v.(T))
+	})
+}
+
+// validate runs T's Validate method, if any, and every validator registered for T.
+// A Validate method with a pointer receiver counts as well.
+func validate[T any](v T) error {
+	var errs []error
+	val, ok := any(v).(Validator)
+	if !ok {
+		val, ok = any(&v).(Validator)
+	}
+	if ok {
+		if err := val.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	validatorsMu.RLock()
+	fns := validators[reflect.TypeFor[T]()]
+	validatorsMu.RUnlock()
+	for _, fn := range fns {
+		if err := fn(v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
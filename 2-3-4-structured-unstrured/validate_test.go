@@ -0,0 +1,118 @@
+package structuredoutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+type testDistance struct {
+	Km float64 `json:"km"`
+}
+
+func (d testDistance) Validate() error {
+	if d.Km < 0 {
+		return fmt.Errorf("km must not be negative")
+	}
+	return nil
+}
+
+type testRoute struct {
+	Stops []string `json:"stops"`
+}
+
+func (r *testRoute) Validate() error {
+	if len(r.Stops) < 2 {
+		return fmt.Errorf("a route needs at least two stops")
+	}
+	return nil
+}
+
+type testCity struct {
+	Name string `json:"name"`
+}
+
+func init() {
+	RegisterValidator(func(c testCity) error {
+		if c.Name != strings.ToLower(c.Name) {
+			return fmt.Errorf("name must be lowercase")
+		}
+		return nil
+	})
+}
+
+func TestGenerateRetriesWithFeedback(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("testDistance", `{"km":"far"}`, `{"km":-1}`, `{"km":12.5}`)
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("how far?"))
+
+	got, err := Generate[testDistance](context.Background(), conv, GenerateOptions{MaxRetries: 2})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if got.Km != 12.5 {
+		t.Errorf("unexpected answer %+v", got)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 calls, got %d", len(calls))
+	}
+	// question, bad answer, feedback, bad answer, feedback
+	last := calls[2].Messages
+	if len(last) != 5 {
+		t.Fatalf("expected 5 messages in final request, got %d", len(last))
+	}
+	feedback := last[4].OfUser.Content.OfString.Value
+	if !strings.Contains(feedback, "km must not be negative") {
+		t.Errorf("feedback does not mention validation error: %q", feedback)
+	}
+}
+
+func TestGeneratePointerValidator(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("testRoute", `{"stops":["rio"]}`, `{"stops":["rio","sao paulo"]}`)
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("which route?"))
+
+	got, err := Generate[testRoute](context.Background(), conv, GenerateOptions{MaxRetries: 1})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(got.Stops) != 2 || len(fake.Calls()) != 2 {
+		t.Errorf("expected a retry for the pointer validator, got %+v after %d calls", got, len(fake.Calls()))
+	}
+}
+
+func TestGenerateRetriesExhausted(t *testing.T) {
+	fake := NewFakeProvider().OnSchema("testCity", `{"name":"Rio de Janeiro"}`)
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("which city?"))
+
+	_, err := Generate[testCity](context.Background(), conv, GenerateOptions{MaxRetries: 1})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(fake.Calls()) != 2 {
+		t.Errorf("expected 2 calls, got %d", len(fake.Calls()))
+	}
+}
+
+func TestGenerateDoesNotRetryRefusal(t *testing.T) {
+	fake := NewFakeProvider().On("testCity", "", FakeResponse{Refusal: "no"})
+	conv := NewChatContext(1, WithProvider(fake))
+	conv.AddMessage(openai.UserMessage("which city?"))
+
+	_, err := Generate[testCity](context.Background(), conv, GenerateOptions{MaxRetries: 3})
+	var refusal *RefusalError
+	if !errors.As(err, &refusal) {
+		t.Fatalf("expected RefusalError, got %v", err)
+	}
+	if len(fake.Calls()) != 1 {
+		t.Errorf("expected 1 call, got %d", len(fake.Calls()))
+	}
+}